@@ -0,0 +1,147 @@
+package dataapi
+
+// Node is a single element of parsed data code
+// Pos returns where the node starts in the source and String returns the
+// exact source text the node was parsed from
+type Node interface {
+	Pos() Pos
+	String() string
+}
+
+// node holds the position and source text shared by all nodes
+type node struct {
+	pos Pos
+	raw string
+}
+
+// Pos returns the position where the node starts in the source
+func (n node) Pos() Pos {
+	return n.pos
+}
+
+// String returns the source text the node was parsed from
+func (n node) String() string {
+	return n.raw
+}
+
+// Script is a parsed data code file
+// Every top level data function call is a statement that is evaluated and reported on individually
+type Script struct {
+	File       string
+	Statements []Node
+}
+
+// Errors returns all the syntax errors found while parsing the script
+func (s *Script) Errors() []error {
+	var out []error
+	for _, statement := range s.Statements {
+		if bad, ok := statement.(*BadNode); ok {
+			out = append(out, bad.Err)
+		}
+	}
+	return out
+}
+
+// Block is a sequence of data function calls written next to each other
+// Eg: [PrintF("Hello World %v", i)][Set(i,i+1,int)]
+type Block struct {
+	node
+	Calls []Node
+}
+
+// Call is a data function call
+// Eg: [PrintF("Hello World %v", i)]
+// Name = PrintF
+// Args = "Hello World %v", i
+type Call struct {
+	node
+	Name string
+	Args []Node
+}
+
+// Ident is a reference to a variable on the EvalCache or a bare word such as a Set type
+// Eg: i, size, string
+type Ident struct {
+	node
+	Name string
+}
+
+// BasicLit is a string, int, decimal or boolean literal
+// Kind is the token kind the literal was lexed from and Value holds the Go value
+// Eg: "Hello World" = string, 10 = int, 2.50 = Decimal, true = bool
+type BasicLit struct {
+	node
+	Kind  TokenKind
+	Value interface{}
+}
+
+// Template is a string literal with {{...}} placeholders
+// Parts holds the text of the string as string BasicLits and the expressions of the placeholders
+// Eg: "Hello {{name}}" = "Hello ", name
+type Template struct {
+	node
+	Parts []Node
+}
+
+// UnaryExpr is an operator applied to a single operand
+// Eg: !done or -1
+type UnaryExpr struct {
+	node
+	Op string
+	X  Node
+}
+
+// BinaryExpr is an operator applied to two operands
+// Eg: i < size or i%2 == 0
+type BinaryExpr struct {
+	node
+	Op string
+	X  Node
+	Y  Node
+}
+
+// Tuple is a parenthesised list of expressions
+// Eg: (voucher, amount) or ()
+type Tuple struct {
+	node
+	Items []Node
+}
+
+// List is a list literal
+// Eg: [1, 2, 3] or ["117-22427-719752", "117-22427-719753"]
+type List struct {
+	node
+	Items []Node
+}
+
+// Index is an element of a list that is accessed by its index, or a field of a map accessed by its key
+// Eg: vouchers[0] or res["Error"]
+type Index struct {
+	node
+	X     Node
+	Index Node
+}
+
+// Selector is a field of a map accessed by its name
+// Eg: res.Failures
+type Selector struct {
+	node
+	X    Node
+	Name string
+}
+
+// NamedArg is a parameter of a call that is given by name
+// Only data functions that accept named parameters, such as Evaluate and Params, can be given named parameters
+// Eg: storeID="Store1"
+type NamedArg struct {
+	node
+	Name  string
+	Value Node
+}
+
+// BadNode is source code that could not be parsed
+// Evaluating a BadNode returns its syntax error
+type BadNode struct {
+	node
+	Err error
+}
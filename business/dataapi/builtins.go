@@ -0,0 +1,466 @@
+package dataapi
+
+// registerBuiltins registers all the data functions that are implemented on the DataAPIService
+// The data functions evaluate their own parameters, so their parameters are declared as TypeCode
+// See the doc comment of every method for the details of the data function
+func registerBuiltins(r *Registry) {
+
+	builtins := []struct {
+		name      string
+		fn        DataFunc
+		signature Signature
+	}{
+		{"AddDuration", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.AddDuration(args[0], args[1])
+		}, Signature{
+			Params: []Param{{Name: "time", Type: TypeAny}, {Name: "duration", Type: TypeAny}},
+			Help:   "AddDuration returns the time with the duration added to it",
+		}},
+		{"Append", nodes(DataAPIService.Append), Signature{
+			Params:   []Param{code("list"), code("items", true)},
+			Variadic: true,
+			Help:     "Append returns a new list with the items added to the end of the list",
+		}},
+		{"AssertContains", nodesErr(DataAPIService.AssertContains), Signature{
+			Params: []Param{code("s"), code("substring")},
+			Help:   "AssertContains fails if the substring is not contained in s",
+		}},
+		{"AssertEquals", nodesErr(DataAPIService.AssertEquals), Signature{
+			Params: []Param{code("actual"), code("expected")},
+			Help:   "AssertEquals fails if the two values are not equal, decimals are compared exactly",
+		}},
+		{"AssertFailure", nodesErr(DataAPIService.AssertFailure), Signature{
+			Params: []Param{code("code")},
+			Help:   "AssertFailure fails if the last core call did not fail with the given error code",
+		}},
+		{"AssertMatches", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return nil, d.AssertMatches(args[0].(string), args[1].(string))
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "re", Type: TypeString}},
+			Help:   "AssertMatches fails if the string does not match the regular expression",
+		}},
+		{"AssertStringArrEquals", nodesErr(DataAPIService.AssertStringArrEquals), Signature{
+			Params: []Param{code("a"), code("b"), code("orderMatters")},
+			Help:   "AssertStringArrEquals fails if the two lists do not hold the same items",
+		}},
+		{"AssertSuccess", noParams(DataAPIService.AssertSuccess), Signature{
+			Help: "AssertSuccess fails if the last core call failed",
+		}},
+		{"AssertWithin", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return nil, d.AssertWithin(args[0], args[1], args[2])
+		}, Signature{
+			Params: []Param{{Name: "t1", Type: TypeAny}, {Name: "t2", Type: TypeAny}, {Name: "duration", Type: TypeAny}},
+			Help:   "AssertWithin fails if the two times are more than the duration apart",
+		}},
+		{"Base64Decode", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Base64Decode(args[0].(string))
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}},
+			Help:   "Base64Decode returns the string held in standard or URL safe base64",
+		}},
+		{"Base64Encode", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Base64Encode(args[0].(string), len(args) == 2 && args[1].(bool)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "url", Type: TypeBool, Optional: true}},
+			Help:   "Base64Encode returns the string encoded in base64, URL safe without padding when url is true",
+		}},
+		{"Break", noParams(DataAPIService.Break), Signature{
+			Help: "Break stops the loop it is called in",
+		}},
+		{"Check", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Check(args[0].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "file", Type: TypeString}},
+			Help:   "Check returns the problems in the data code of a file without running it",
+		}},
+		{"Contains", nodes(DataAPIService.Contains), Signature{
+			Params: []Param{code("collection"), code("item")},
+			Help:   "Contains returns true if a list contains the item or a string contains the substring",
+		}},
+		{"Continue", noParams(DataAPIService.Continue), Signature{
+			Help: "Continue skips the rest of the current iteration of the loop it is called in",
+		}},
+		{"Env", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			if len(args) == 2 {
+				def := args[1].(string)
+				return d.Env(args[0].(string), &def)
+			}
+			return d.Env(args[0].(string), nil)
+		}, Signature{
+			Params: []Param{{Name: "name", Type: TypeString}, {Name: "default", Type: TypeString, Optional: true}},
+			Help:   "Env returns the value of the environment variable, or the default when it is not set",
+		}},
+		{"Evaluate", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			named, err := d.evalNamed(args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return d.EvaluateWith(d.context(), args[0].(string), named), nil
+		}, Signature{
+			Params: []Param{{Name: "file", Type: TypeString}},
+			Named:  true,
+			Help:   "Evaluate runs the data code of a file or directory with the named parameters and adds its results to the report",
+		}},
+		{"ExpectFail", nodes(DataAPIService.ExpectFail), Signature{
+			Params: []Param{code("body"), code("expected")},
+			Help:   "ExpectFail runs the body and fails unless the body fails with an error matching expected",
+		}},
+		{"Export", nodes(DataAPIService.Export), Signature{
+			Params:   []Param{code("variables")},
+			Variadic: true,
+			Help:     "Export makes variables of the current file available to the file that Evaluated it",
+		}},
+		{"Extract", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			group := -1
+			if len(args) == 3 {
+				group = args[2].(int)
+			}
+			return d.Extract(args[0].(string), args[1].(string), group)
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "re", Type: TypeString}, {Name: "group", Type: TypeInt, Optional: true}},
+			Help:   "Extract returns the group of the regular expression matched in the string, the first group by default",
+		}},
+		{"Fail", str(DataAPIService.Fail), Signature{
+			Params: []Param{{Name: "message", Type: TypeString}},
+			Help:   "Fail fails with the given message",
+		}},
+		{"For", nodes(DataAPIService.For), Signature{
+			Params: []Param{code("condition"), code("body")},
+			Help:   "For runs the body for as long as the condition is true",
+		}},
+		{"ForEach", nodes(DataAPIService.ForEach), Signature{
+			Params: []Param{code("index", true), code("item"), code("collection"), code("body")},
+			Help:   "ForEach runs the body once for every item in a list, JSON array or string delimited by ___",
+		}},
+		{"ForEachRow", nodes(DataAPIService.ForEachRow), Signature{
+			Params: []Param{code("rows"), code("name", true), code("body")},
+			Help:   "ForEachRow runs the body once for every row of a CSV or JSON data file with the columns set as variables",
+		}},
+		{"Format", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Format(args[0].(string), args[1:]), nil
+		}, Signature{
+			Params:   []Param{{Name: "format", Type: TypeString}, {Name: "values", Type: TypeAny, Optional: true}},
+			Variadic: true,
+			Help:     "Format returns the formatted values, just like fmt.Sprintf",
+		}},
+		{"FormatTime", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.FormatTime(args[0], args[1].(string))
+		}, Signature{
+			Params: []Param{{Name: "time", Type: TypeAny}, {Name: "layout", Type: TypeString}},
+			Help:   "FormatTime returns the time formatted with a Go time layout or a layout name such as RFC3339 or DateTime",
+		}},
+		{"Func", nodes(DataAPIService.Func), Signature{
+			Params: []Param{code("name"), code("params"), code("body"), code("result", true)},
+			Help:   "Func defines a data function that is called like any other data function",
+		}},
+		{"Global", nodes(DataAPIService.Global), Signature{
+			Params:   []Param{code("variables")},
+			Variadic: true,
+			Help:     "Global makes reads and writes of the variables use the global EvalCache",
+		}},
+		{"HMAC", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			encoding := "hex"
+			if len(args) == 4 {
+				encoding = args[3].(string)
+			}
+			return d.HMAC(args[0].(string), args[1].(string), args[2].(string), encoding)
+		}, Signature{
+			Params: []Param{
+				{Name: "alg", Type: TypeString},
+				{Name: "key", Type: TypeString},
+				{Name: "msg", Type: TypeString},
+				{Name: "encoding", Type: TypeString, Optional: true},
+			},
+			Help: "HMAC returns the HMAC of the message signed with the key, encoded in hex, base64, base64url or raw",
+		}},
+		{"Help", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Help(args[0].(string))
+		}, Signature{
+			Params: []Param{{Name: "name", Type: TypeString}},
+			Help:   "Help returns how a data function is called and what it does",
+		}},
+		{"HexEncode", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.HexEncode(args[0].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}},
+			Help:   "HexEncode returns the string encoded in hex",
+		}},
+		{"If", nodes(DataAPIService.If), Signature{
+			Params: []Param{code("condition"), code("then"), code("else", true)},
+			Help:   "If runs then if the condition is true, otherwise else",
+		}},
+		{"IfElse", nodes(DataAPIService.IfElse), Signature{
+			Params:   []Param{code("condition"), code("body"), code("branches", true)},
+			Variadic: true,
+			Help:     "IfElse runs the body of the first condition that is true, or the last body if none are",
+		}},
+		{"Import", str(DataAPIService.Import), Signature{
+			Params: []Param{{Name: "file", Type: TypeString}},
+			Help:   "Import loads the variables and functions defined in a library file into the current scope",
+		}},
+		{"JWTDecode", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.JWTDecode(args[0].(string))
+		}, Signature{
+			Params: []Param{{Name: "token", Type: TypeString}},
+			Help:   "JWTDecode returns the claims of a JSON Web Token without verifying its signature",
+		}},
+		{"JWTSign", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.JWTSign(args[0], args[1].(string), args[2].(string))
+		}, Signature{
+			Params: []Param{{Name: "claims", Type: TypeAny}, {Name: "key", Type: TypeString}, {Name: "alg", Type: TypeString}},
+			Help:   "JWTSign returns a JSON Web Token holding the claims, signed with HS256, HS384, HS512, RS256, RS384 or RS512",
+		}},
+		{"Join", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Join(args[0].([]interface{}), args[1].(string))
+		}, Signature{
+			Params: []Param{{Name: "list", Type: TypeList}, {Name: "sep", Type: TypeString}},
+			Help:   "Join returns the items of the list joined into a string with the separator between them",
+		}},
+		{"Len", nodes(DataAPIService.Len), Signature{
+			Params: []Param{code("value")},
+			Help:   "Len returns the number of items in a list or map or the number of characters in a string",
+		}},
+		{"Lower", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Lower(args[0].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}},
+			Help:   "Lower returns the string in lower case",
+		}},
+		{"Match", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Match(args[0].(string), args[1].(string))
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "re", Type: TypeString}},
+			Help:   "Match returns true if the string matches the regular expression",
+		}},
+		{"Now", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			layout := ""
+			if len(args) == 1 {
+				layout = args[0].(string)
+			}
+			return d.Now(layout), nil
+		}, Signature{
+			Params: []Param{{Name: "layout", Type: TypeString, Optional: true}},
+			Help:   "Now returns the current time, or the frozen clock of the run, formatted with the layout if one is given",
+		}},
+		{"ParallelPost", nodes(DataAPIService.ParallelPost), Signature{
+			Params: []Param{code("files"), code("headers"), code("jsons"), code("urls")},
+			Help:   "ParallelPost sends POST requests in parallel and saves the responses as ParallelPostX",
+		}},
+		{"Params", nodes(DataAPIService.Params), Signature{
+			Params:   []Param{code("required", true)},
+			Variadic: true,
+			Named:    true,
+			Help:     "Params declares the named parameters a file is Evaluated with, named parameters of Params are optional with a default",
+		}},
+		{"ParseTime", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			layout := "RFC3339"
+			if len(args) == 2 {
+				layout = args[1].(string)
+			}
+			return d.ParseTime(args[0].(string), layout)
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "layout", Type: TypeString, Optional: true}},
+			Help:   "ParseTime returns the time held in the string, parsed with the layout or RFC3339 by default",
+		}},
+		{"Pass", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			d.Pass(toNodes(args))
+			return nil, nil
+		}, Signature{
+			Params:   []Param{code("parameters", true)},
+			Variadic: true,
+			Help:     "Pass does nothing and can not fail",
+		}},
+		{"Post", nodes(DataAPIService.Post), Signature{
+			Params: []Param{code("url"), code("json"), code("headers")},
+			Help:   "Post sends a POST request and saves the response as res",
+		}},
+		{"PrintF", nodes(DataAPIService.PrintF), Signature{
+			Params:   []Param{code("format"), code("values", true)},
+			Variadic: true,
+			Help:     "PrintF logs the formatted values",
+		}},
+		{"RandomChoice", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.RandomChoice(args[0].([]interface{}))
+		}, Signature{
+			Params: []Param{{Name: "list", Type: TypeList}},
+			Help:   "RandomChoice returns a random item of the list",
+		}},
+		{"RandomInt", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.RandomInt(args[0].(int), args[1].(int))
+		}, Signature{
+			Params: []Param{{Name: "min", Type: TypeInt}, {Name: "max", Type: TypeInt}},
+			Help:   "RandomInt returns a random int between min and max, both included",
+		}},
+		{"RandomString", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			charset := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+			if len(args) == 2 {
+				charset = args[1].(string)
+			}
+			return d.RandomString(args[0].(int), charset)
+		}, Signature{
+			Params: []Param{{Name: "n", Type: TypeInt}, {Name: "charset", Type: TypeString, Optional: true}},
+			Help:   "RandomString returns a random string of n characters chosen from the charset, letters and digits by default",
+		}},
+		{"ReadFile", nodes(DataAPIService.ReadFile), Signature{
+			Params: []Param{code("variable"), code("path")},
+			Help:   "ReadFile saves the contents of the file under the variable",
+		}},
+		{"Replace", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Replace(args[0].(string), args[1].(string), args[2].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "old", Type: TypeString}, {Name: "new", Type: TypeString}},
+			Help:   "Replace returns the string with every occurrence of old replaced by new",
+		}},
+		{"Res", nodes(DataAPIService.Res), Signature{
+			Params: []Param{code("field")},
+			Help:   "Res returns the given variable",
+		}},
+		{"Return", nodes(DataAPIService.Return), Signature{
+			Params: []Param{code("value", true)},
+			Help:   "Return stops the function or file it is called in, with an optional value",
+		}},
+		{"SHA256", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			encoding := "hex"
+			if len(args) == 2 {
+				encoding = args[1].(string)
+			}
+			return d.SHA256(args[0].(string), encoding)
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "encoding", Type: TypeString, Optional: true}},
+			Help:   "SHA256 returns the SHA-256 hash of the string, encoded in hex, base64, base64url or raw",
+		}},
+		{"Secret", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Secret(args[0].(string))
+		}, Signature{
+			Params: []Param{{Name: "name", Type: TypeString}},
+			Help:   "Secret returns the value of the secret, which is redacted from the logs, report and failures of the run",
+		}},
+		{"Sequence", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Sequence(args[0].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "name", Type: TypeString}},
+			Help:   "Sequence returns the next number of the named sequence, starting at 1",
+		}},
+		{"Set", nodes(DataAPIService.Set), Signature{
+			Params: []Param{code("variable"), code("value"), code("type")},
+			Help:   "Set sets the variable to the value converted to the type",
+		}},
+		{"Sleep", nodes(DataAPIService.Sleep), Signature{
+			Params: []Param{code("seconds")},
+			Help:   "Sleep waits for the given number of seconds",
+		}},
+		{"Split", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Split(args[0].(string), args[1].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "sep", Type: TypeString}},
+			Help:   "Split returns the parts of the string separated by the separator as a list",
+		}},
+		{"Substr", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			length := -1
+			if len(args) == 3 {
+				length = args[2].(int)
+			}
+			return d.Substr(args[0].(string), args[1].(int), length)
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "start", Type: TypeInt}, {Name: "length", Type: TypeInt, Optional: true}},
+			Help:   "Substr returns length characters of the string from start, or the rest of the string",
+		}},
+		{"Switch", nodes(DataAPIService.Switch), Signature{
+			Params:   []Param{code("value"), code("case"), code("body"), code("cases", true)},
+			Variadic: true,
+			Help:     "Switch runs the body of the first case equal to the value, or the last body if none are",
+		}},
+		{"Timeout", nodes(DataAPIService.Timeout), Signature{
+			Params: []Param{code("seconds"), code("body", true)},
+			Help:   "Timeout fails if the body does not finish within the given seconds, without a body it limits the rest of the file",
+		}},
+		{"Trim", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			cutset := ""
+			if len(args) == 2 {
+				cutset = args[1].(string)
+			}
+			return d.Trim(args[0].(string), cutset), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}, {Name: "cutset", Type: TypeString, Optional: true}},
+			Help:   "Trim returns the string without leading and trailing white space, or the characters of the cutset",
+		}},
+		{"Try", nodes(DataAPIService.Try), Signature{
+			Params: []Param{code("body"), code("variable", true), code("catch")},
+			Help:   "Try runs the catch code with the error message as err if the body fails",
+		}},
+		{"URLEncode", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.URLEncode(args[0])
+		}, Signature{
+			Params: []Param{{Name: "value", Type: TypeAny}},
+			Help:   "URLEncode returns the string escaped for a URL, or the map encoded as a query string",
+		}},
+		{"UUID", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.UUID()
+		}, Signature{
+			Help: "UUID returns a random version 4 UUID",
+		}},
+		{"Upper", func(d DataAPIService, args []interface{}) (interface{}, error) {
+			return d.Upper(args[0].(string)), nil
+		}, Signature{
+			Params: []Param{{Name: "s", Type: TypeString}},
+			Help:   "Upper returns the string in upper case",
+		}},
+		{"While", nodes(DataAPIService.While), Signature{
+			Params: []Param{code("condition"), code("body")},
+			Help:   "While runs the body for as long as the condition is true",
+		}},
+	}
+
+	for _, builtin := range builtins {
+		if err := r.Register(builtin.name, builtin.fn, builtin.signature); err != nil {
+			panic(err)
+		}
+	}
+
+}
+
+// code declares a parameter that the data function evaluates itself
+func code(name string, optional ...bool) Param {
+	return Param{Name: name, Type: TypeCode, Optional: len(optional) > 0 && optional[0]}
+}
+
+// nodes adapts a data function method that evaluates its own parameters and returns a value or an error
+func nodes(method func(DataAPIService, []Node) interface{}) DataFunc {
+	return func(d DataAPIService, args []interface{}) (interface{}, error) {
+		val := method(d, toNodes(args))
+		if err, ok := val.(error); ok {
+			return nil, err
+		}
+		return val, nil
+	}
+}
+
+// nodesErr adapts a data function method that evaluates its own parameters and returns an error
+func nodesErr(method func(DataAPIService, []Node) error) DataFunc {
+	return func(d DataAPIService, args []interface{}) (interface{}, error) {
+		return nil, method(d, toNodes(args))
+	}
+}
+
+// noParams adapts a data function method without parameters
+func noParams(method func(DataAPIService) error) DataFunc {
+	return func(d DataAPIService, args []interface{}) (interface{}, error) {
+		return nil, method(d)
+	}
+}
+
+// str adapts a data function method with a single string parameter
+func str(method func(DataAPIService, string) error) DataFunc {
+	return func(d DataAPIService, args []interface{}) (interface{}, error) {
+		return nil, method(d, args[0].(string))
+	}
+}
+
+// toNodes converts the TypeCode arguments of a data function back to their nodes
+func toNodes(args []interface{}) []Node {
+	out := make([]Node, len(args))
+	for i, arg := range args {
+		out[i] = arg.(Node)
+	}
+	return out
+}
@@ -0,0 +1,392 @@
+package dataapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// setTypes holds the types that Set accepts
+var setTypes = map[string]bool{
+	"string":   true,
+	"int":      true,
+	"float":    true,
+	"decimal":  true,
+	"boolean":  true,
+	"list":     true,
+	"[]string": true,
+	"[]int":    true,
+	"json":     true,
+	"map":      true,
+	"time":     true,
+	"duration": true,
+}
+
+// checker finds problems in data code without running it
+type checker struct {
+	d        DataAPIService
+	problems []string
+	seen     map[string]bool
+	imports  map[string]*checkScope
+	checking []string
+	pending  []func()
+}
+
+// checkScope holds the names that are defined at a point in a data code file
+// functions maps the names of functions defined with Func to their number of parameters
+// numbered holds the prefixes of numbered variables whose count is only known at run time, such as ParallelPost
+type checkScope struct {
+	vars      map[string]bool
+	functions map[string]int
+	numbered  map[string]bool
+	exports   []string
+	parent    *checkScope
+}
+
+// newCheckScope creates a scope layered over the parent scope
+func newCheckScope(parent *checkScope) *checkScope {
+	return &checkScope{vars: map[string]bool{}, functions: map[string]int{}, numbered: map[string]bool{}, parent: parent}
+}
+
+// defined returns true if the variable is defined in the scope or any parent scope
+func (s *checkScope) defined(name string) bool {
+	for scope := s; scope != nil; scope = scope.parent {
+		if _, ok := scope.functions[name]; ok || scope.vars[name] {
+			return true
+		}
+		for prefix := range scope.numbered {
+			if n := strings.TrimPrefix(name, prefix); n != name && n != "" && strings.Trim(n, "0123456789") == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// function returns the number of parameters of a function defined with Func
+func (s *checkScope) function(name string) (int, bool) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if n, ok := scope.functions[name]; ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// root creates the scope of the variables that are already on the EvalCache
+func (c *checker) root() *checkScope {
+	scope := newCheckScope(nil)
+	for name, val := range c.d.EvalCache {
+		if function, ok := val.(*Function); ok {
+			scope.functions[name] = len(function.Params)
+			continue
+		}
+		scope.vars[name] = true
+	}
+	return scope
+}
+
+// problem records a problem found at the given position
+// The same problem is only recorded once, even if the file is checked more than once
+func (c *checker) problem(pos Pos, format string, args ...interface{}) {
+	problem := strings.Replace(fmt.Sprintf("%v: %v", pos, fmt.Sprintf(format, args...)), "configs/dataapi/", "", -1)
+	if c.seen[problem] {
+		return
+	}
+	c.seen[problem] = true
+	c.problems = append(c.problems, problem)
+}
+
+// checkFile checks the data code file or every file in the directory
+// The file is checked in a scope layered over the parent scope, which is returned
+func (c *checker) checkFile(inFile string, parent *checkScope) *checkScope {
+
+	scope := newCheckScope(parent)
+	for _, checking := range c.checking {
+		if checking == inFile {
+			return scope
+		}
+	}
+	c.checking = append(c.checking, inFile)
+	defer func() {
+		c.checking = c.checking[:len(c.checking)-1]
+	}()
+
+	filepath := "configs/dataapi/" + inFile
+	if info, err := os.Stat(filepath); err == nil && info.IsDir() {
+		files, err := ioutil.ReadDir(filepath)
+		if err != nil {
+			c.problem(Pos{File: filepath}, "%v", err)
+			return scope
+		}
+		for _, file := range files {
+			c.checkFile(inFile+"/"+file.Name(), parent)
+		}
+		return scope
+	}
+	dataRaw, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		c.problem(Pos{File: filepath}, "%v", err)
+		return scope
+	}
+
+	script := ParseScript(filepath, string(dataRaw))
+	for _, err := range script.Errors() {
+		c.problems = append(c.problems, strings.Replace(err.Error(), "configs/dataapi/", "", -1))
+	}
+
+	// The bodies of functions are checked once the whole file has been checked,
+	// as a function may use variables that are set after it is defined
+	pending := c.pending
+	c.pending = nil
+	for _, statement := range script.Statements {
+		c.walk(statement, scope)
+	}
+	for i := 0; i < len(c.pending); i++ {
+		c.pending[i]()
+	}
+	c.pending = pending
+
+	return scope
+
+}
+
+// walk checks an expression and everything nested inside it
+func (c *checker) walk(n Node, scope *checkScope) {
+	switch n := n.(type) {
+	case *Call:
+		c.checkCall(n, scope)
+	case *Ident:
+		if !scope.defined(n.Name) {
+			c.problem(n.Pos(), "variable %v is not defined", n.Name)
+		}
+	case *Block:
+		c.walkAll(n.Calls, scope)
+	case *Tuple:
+		c.walkAll(n.Items, scope)
+	case *List:
+		c.walkAll(n.Items, scope)
+	case *Template:
+		c.walkAll(n.Parts, scope)
+	case *Index:
+		c.walk(n.X, scope)
+		c.walk(n.Index, scope)
+	case *Selector:
+		c.walk(n.X, scope)
+	case *UnaryExpr:
+		c.walk(n.X, scope)
+	case *BinaryExpr:
+		c.walk(n.X, scope)
+		c.walk(n.Y, scope)
+	}
+}
+
+// walkAll checks every expression in order
+func (c *checker) walkAll(nodes []Node, scope *checkScope) {
+	for _, n := range nodes {
+		c.walk(n, scope)
+	}
+}
+
+// checkCall checks that the data function exists and is called with the right number of parameters
+// The data functions that define variables or run code in a new scope are followed so that
+// variables are only reported as undefined when they would be undefined when the code runs
+func (c *checker) checkCall(call *Call, scope *checkScope) {
+
+	args, named, err := splitNamed(call.Args)
+	if err != nil {
+		c.problem(call.Pos(), "%v", err)
+		return
+	}
+	for _, arg := range named {
+		c.walk(arg.(*NamedArg).Value, scope)
+	}
+	function, ok := c.d.registry().Lookup(call.Name)
+	if !ok {
+		n, ok := scope.function(call.Name)
+		if !ok && c.d.hasCoreFunction(call.Name) {
+			scope.vars["res"] = true
+		} else if !ok {
+			c.problem(call.Pos(), "data function %v not found", call.Name)
+		} else if n != len(args) {
+			c.problem(call.Pos(), "%v expected %v parameters but got: %v", call.Name, n, len(args))
+		}
+		if len(named) > 0 {
+			c.problem(call.Pos(), "%v does not accept named parameters", call.Name)
+		}
+		c.walkAll(args, scope)
+		return
+	}
+
+	// Check the number of parameters against the signature of the data function
+	if len(named) > 0 && !function.Signature.Named {
+		c.problem(call.Pos(), "%v does not accept named parameters", call.Name)
+	}
+	if arity := function.Signature.arity(); !arity.accepts(len(args)) {
+		c.problem(call.Pos(), "%v expected %v parameters but got: %v", call.Name, arity, len(args))
+		return
+	}
+
+	switch call.Name {
+	case "Set":
+		c.walk(args[1], scope)
+		variableType := strings.TrimSpace(args[2].String())
+		if !setTypes[variableType] {
+			c.problem(args[2].Pos(), "variableType \"%v\" does not exist", variableType)
+		}
+		scope.vars[strings.TrimSpace(args[0].String())] = true
+	case "Func":
+		name := strings.TrimSpace(args[0].String())
+		body := newCheckScope(scope)
+		var params []Node
+		switch list := args[1].(type) {
+		case *Ident:
+			params = []Node{list}
+		case *Tuple:
+			params = list.Items
+		}
+		for _, param := range params {
+			variable := strings.TrimSpace(param.String())
+			if body.vars[variable] {
+				c.problem(param.Pos(), "parameter %v of %v is declared more than once", variable, name)
+			}
+			body.vars[variable] = true
+		}
+		scope.functions[name] = len(params)
+		c.pending = append(c.pending, func() {
+			c.walkAll(args[2:], body)
+		})
+	case "For", "While":
+		c.walk(args[0], scope)
+		c.walk(args[1], newCheckScope(scope))
+	case "ForEach":
+		c.walk(args[len(args)-2], scope)
+		body := newCheckScope(scope)
+		for _, variable := range args[:len(args)-2] {
+			body.vars[strings.TrimSpace(variable.String())] = true
+		}
+		c.walk(args[len(args)-1], body)
+	case "ForEachRow":
+		// The columns are only known when the data file is given as a literal
+		c.walkAll(args[:len(args)-1], scope)
+		file, ok := literal(args[0])
+		if !ok {
+			return
+		}
+		rows, err := readRows("configs/dataapi/" + file)
+		if err != nil {
+			c.problem(args[0].Pos(), "could not read %v: %v", file, err)
+			return
+		}
+		body := newCheckScope(scope)
+		for _, row := range rows {
+			for column := range row {
+				body.vars[column] = true
+			}
+		}
+		body.vars["row"] = true
+		c.walk(args[len(args)-1], body)
+	case "Try":
+		c.walk(args[0], scope)
+		catch := newCheckScope(scope)
+		if len(args) == 3 {
+			catch.vars[strings.TrimSpace(args[1].String())] = true
+		} else {
+			catch.vars["err"] = true
+		}
+		c.walk(args[len(args)-1], catch)
+	case "Params":
+		for _, variable := range args {
+			scope.vars[strings.TrimSpace(variable.String())] = true
+		}
+		for _, variable := range named {
+			scope.vars[variable.(*NamedArg).Name] = true
+		}
+	case "Global":
+		for _, variable := range args {
+			scope.vars[strings.TrimSpace(variable.String())] = true
+		}
+	case "Export":
+		c.walkAll(args, scope)
+		for _, variable := range args {
+			scope.exports = append(scope.exports, strings.TrimSpace(variable.String()))
+		}
+	case "Evaluate":
+		target, ok := literal(args[0])
+		if !ok {
+			c.walk(args[0], scope)
+			return
+		}
+		if _, err := os.Stat("configs/dataapi/" + target); err != nil {
+			c.problem(args[0].Pos(), "could not read %v: %v", target, err)
+			return
+		}
+		evaluated := c.checkFile(target, scope)
+		for _, variable := range evaluated.exports {
+			scope.vars[variable] = true
+		}
+	case "Import":
+		target, ok := literal(args[0])
+		if !ok {
+			c.walk(args[0], scope)
+			return
+		}
+		if _, err := os.Stat("configs/dataapi/" + target); err != nil {
+			c.problem(args[0].Pos(), "could not read %v: %v", target, err)
+			return
+		}
+		library, ok := c.imports[target]
+		if !ok {
+			library = c.checkFile(target, c.root())
+			c.imports[target] = library
+		}
+		for name := range library.vars {
+			scope.vars[name] = true
+		}
+		for prefix := range library.numbered {
+			scope.numbered[prefix] = true
+		}
+		for name, n := range library.functions {
+			scope.functions[name] = n
+		}
+	case "ReadFile":
+		c.walkAll(args, scope)
+		if path, ok := literal(args[1]); ok {
+			if _, err := os.Stat(path); err != nil {
+				c.problem(args[1].Pos(), "could not read %v: %v", path, err)
+			}
+		}
+		if variable, ok := literal(args[0]); ok {
+			scope.vars[variable] = true
+		}
+	case "Post":
+		c.walkAll(args, scope)
+		scope.vars["res"] = true
+	case "ParallelPost":
+		// The responses are numbered from 0 and there is one for every url,
+		// which is only known here when the urls are given as a literal list
+		c.walkAll(args, scope)
+		urls, ok := args[3].(*List)
+		if !ok {
+			scope.numbered["ParallelPost"] = true
+			return
+		}
+		for i := range urls.Items {
+			scope.vars[fmt.Sprintf("ParallelPost%v", i)] = true
+		}
+	default:
+		c.walkAll(args, scope)
+	}
+
+}
+
+// literal returns the value of a string literal
+func literal(n Node) (string, bool) {
+	lit, ok := n.(*BasicLit)
+	if !ok {
+		return "", false
+	}
+	s, ok := lit.Value.(string)
+	return s, ok
+}
@@ -0,0 +1,259 @@
+package dataapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Celbux/dataapi/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// CoreDataAPI is the core backend that a host service plugs into the Data API
+// Data functions that are neither registered nor defined with Func are called on the core by name
+// Eg: [Pay("117-22427-719752", 2000)] calls Call(ctx, "Pay", ["117-22427-719752", 2000])
+// Call returns the core res array, where a failed call has a negative error code as its first item
+// Eg: ["-22", "insufficient funds"]
+// An error is only returned when the core could not be reached, and fails the data code that made the call
+type CoreDataAPI interface {
+	Functions() []string
+	Call(ctx context.Context, name string, args []interface{}) ([]string, error)
+}
+
+// Response is the normalised result of a core call or a Post, which is saved as res
+// Success is false when core returned a negative error code, which is then held in Code
+// Values holds the res array of a core call and Body holds the raw response body
+// Printing a Response prints its Body, so existing data code that treats res as a string keeps working
+// Fields are read with res.Success, res.Code, res.Values and res.Body, any other field or index is read from the
+// res array of a core call or the JSON body of a Post
+// Eg: res[1] or res.Failures[0]
+type Response struct {
+	Success bool
+	Code    string
+	Values  []string
+	Body    string
+}
+
+// NewResponse normalises the result of a core call or a Post to a Response
+// A core res array fails when its first item is a negative error code and a Post body always succeeds
+// Eg: ["-22", "insufficient funds"] fails with Code "-22"
+func NewResponse(v interface{}) (Response, error) {
+
+	switch v := v.(type) {
+	case Response:
+		return v, nil
+	case []string:
+		if len(v) == 0 {
+			return Response{}, errors.New("res[] struct returned from core is empty")
+		}
+		body, err := json.Marshal(v)
+		if err != nil {
+			return Response{}, err
+		}
+		res := Response{Success: true, Values: v, Body: string(body)}
+		if strings.HasPrefix(v[0], "-") {
+			res.Success, res.Code = false, v[0]
+		}
+		return res, nil
+	case []interface{}:
+		values, err := toStrings(v)
+		if err != nil {
+			return Response{}, err
+		}
+		return NewResponse(values)
+	case string:
+		if v == "" {
+			return Response{Success: true, Values: []string{"success"}, Body: "success"}, nil
+		}
+		return Response{Success: true, Body: v}, nil
+	case map[string]interface{}:
+		body, err := json.Marshal(v)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Success: true, Body: string(body)}, nil
+	}
+
+	return Response{}, errors.Errorf("%v is not a core or Post response", v)
+
+}
+
+// String returns the body of the response
+func (r Response) String() string {
+	return r.Body
+}
+
+// value returns the res array of a core call, or the body of a Post
+func (r Response) value() interface{} {
+	if r.Values != nil {
+		return r.Values
+	}
+	return r.Body
+}
+
+// field returns one of the fields of the response
+func (r Response) field(name string) (interface{}, bool) {
+	switch name {
+	case "Success":
+		return r.Success, true
+	case "Code":
+		return r.Code, true
+	case "Values":
+		return r.Values, true
+	case "Body":
+		return r.Body, true
+	}
+	return nil, false
+}
+
+// callCore calls a core function and saves its normalised response as res
+// The response is also returned, so it can be used directly
+// Eg: [Set(balance, [Balance("wallet1")].Values[1], int)]
+func (d DataAPIService) callCore(name string, parameters []Node) (interface{}, error) {
+
+	// Gets the parameters
+	args := make([]interface{}, len(parameters))
+	for i, parameter := range parameters {
+		val, err := d.EvalNode(parameter)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	// Call core and normalise the response
+	values, err := d.Core.Call(d.context(), name, args)
+	if done := d.done(); done != nil {
+		return nil, done
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "core %v", name)
+	}
+	res, err := NewResponse(values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "core %v", name)
+	}
+	d.scope().Set("res", res)
+
+	// Return the response
+	return res, nil
+
+}
+
+// response returns res normalised to a Response
+// res is usually saved by a core call or Post, but may also be set by data code
+func (d DataAPIService) response() (Response, error) {
+	resRaw, ok := d.scope().Get("res")
+	if !ok || resRaw == nil {
+		return Response{}, errors.New("res[] struct returned from core is empty")
+	}
+	return NewResponse(resRaw)
+}
+
+// hasCoreFunction returns true if the core of the service implements the function
+func (d DataAPIService) hasCoreFunction(name string) bool {
+	if d.Core == nil {
+		return false
+	}
+	for _, function := range d.Core.Functions() {
+		if function == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CoreCall is a single call made to a FakeCore
+type CoreCall struct {
+	Name string
+	Args []interface{}
+}
+
+// FakeCore is an in-process CoreDataAPI for tests
+// Every core function is a Go function, and every call is recorded in order
+// Eg: core.Handle("Pay", pay) makes [Pay("117-22427-719752", 2000)] call pay with the evaluated parameters
+// The fake is given to the service to use with DataAPIService{Core: core}
+type FakeCore struct {
+	mu        sync.Mutex
+	functions map[string]func(args []interface{}) ([]string, error)
+	calls     []CoreCall
+}
+
+// NewFakeCore creates a FakeCore without any functions
+func NewFakeCore() *FakeCore {
+	return &FakeCore{functions: make(map[string]func(args []interface{}) ([]string, error))}
+}
+
+// Handle implements the core function with the given Go function
+func (f *FakeCore) Handle(name string, fn func(args []interface{}) ([]string, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.functions[name] = fn
+}
+
+// Functions returns the names of the functions of the fake in alphabetical order
+func (f *FakeCore) Functions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.functions))
+	for name := range f.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call records the call and runs the function that implements it
+func (f *FakeCore) Call(ctx context.Context, name string, args []interface{}) ([]string, error) {
+	f.mu.Lock()
+	fn, ok := f.functions[name]
+	f.calls = append(f.calls, CoreCall{Name: name, Args: args})
+	f.mu.Unlock()
+	if !ok {
+		return nil, errors.Errorf("core function %v not found", name)
+	}
+	return fn(args)
+}
+
+// Calls returns every call made to the fake in order
+func (f *FakeCore) Calls() []CoreCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CoreCall{}, f.calls...)
+}
+
+// HTTPCore is a CoreDataAPI that calls a core service over HTTP
+// Every call is a POST request to URL + "/" + name with the JSON body {"Params": args}
+// The core service responds with its res array as a JSON array of strings
+// Names holds the functions the core service implements
+type HTTPCore struct {
+	URL     string
+	Headers map[string]string
+	Names   []string
+}
+
+// Functions returns the functions the core service implements
+func (c HTTPCore) Functions() []string {
+	return c.Names
+}
+
+// Call sends the call to the core service
+func (c HTTPCore) Call(ctx context.Context, name string, args []interface{}) ([]string, error) {
+
+	body := map[string]interface{}{"Params": args}
+	resp, err := web.DoRequest(ctx, strings.TrimRight(c.URL, "/")+"/"+name, c.Headers, http.MethodPost, body)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	err = json.Unmarshal(resp, &res)
+	if err != nil {
+		return nil, errors.Wrapf(err, "core %v did not respond with a res[] array", name)
+	}
+
+	return res, nil
+
+}
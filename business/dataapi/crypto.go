@@ -0,0 +1,171 @@
+package dataapi
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hashes are the hash algorithms that HMAC and JWTSign can use by name
+var hashes = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+// newHash returns the constructor of the named hash algorithm
+// Eg: "SHA256" or "sha256"
+func newHash(name string) (crypto.Hash, func() hash.Hash, error) {
+	h, ok := hashes[strings.ToUpper(strings.TrimSpace(name))]
+	if !ok {
+		return 0, nil, errors.Errorf("hash algorithm %v does not exist, use SHA1, SHA256, SHA384 or SHA512", name)
+	}
+	switch h {
+	case crypto.SHA1:
+		return h, sha1.New, nil
+	case crypto.SHA384:
+		return h, sha512.New384, nil
+	case crypto.SHA512:
+		return h, sha512.New, nil
+	}
+	return h, sha256.New, nil
+}
+
+// encode encodes a digest or signature as a string
+// The encoding is hex, base64, base64url or raw, which leaves the bytes as is
+func encode(b []byte, encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	case "raw":
+		return string(b), nil
+	}
+	return "", errors.Errorf("encoding %v does not exist, use hex, base64, base64url or raw", encoding)
+}
+
+// decodeBase64 decodes standard and URL safe base64, with or without padding
+func decodeBase64(s string) ([]byte, error) {
+
+	s = strings.TrimSpace(s)
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := encoding.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+
+	return nil, errors.Errorf("%v is not base64", s)
+
+}
+
+// signJWT signs the claims as a JSON Web Token
+// The HS algorithms sign with the key as a secret and the RS algorithms with the key as a PEM encoded RSA private key
+// Eg: HS256, HS384, HS512, RS256, RS384 or RS512
+func signJWT(claims map[string]interface{}, key string, alg string) (string, error) {
+
+	// Gets the hash of the algorithm
+	alg = strings.ToUpper(strings.TrimSpace(alg))
+	if len(alg) != 5 || (alg[:2] != "HS" && alg[:2] != "RS") {
+		return "", errors.Errorf("JWT algorithm %v does not exist, use HS256, HS384, HS512, RS256, RS384 or RS512", alg)
+	}
+	h, newH, err := newHash("SHA" + alg[2:])
+	if err != nil || h == crypto.SHA1 {
+		return "", errors.Errorf("JWT algorithm %v does not exist, use HS256, HS384, HS512, RS256, RS384 or RS512", alg)
+	}
+
+	// Encode the header and claims
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	// Sign the header and claims
+	var signature []byte
+	if alg[:2] == "HS" {
+		mac := hmac.New(newH, []byte(key))
+		mac.Write([]byte(unsigned))
+		signature = mac.Sum(nil)
+	} else {
+		private, err := parseRSAKey(key)
+		if err != nil {
+			return "", err
+		}
+		digest := newH()
+		digest.Write([]byte(unsigned))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, private, h, digest.Sum(nil))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+
+}
+
+// parseRSAKey parses a PEM encoded RSA private key in PKCS1 or PKCS8
+func parseRSAKey(key string) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("key is not a PEM encoded RSA private key")
+	}
+	if private, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return private, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("key is not a PEM encoded RSA private key")
+	}
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not a PEM encoded RSA private key")
+	}
+
+	return private, nil
+
+}
+
+// decodeJWT returns the claims of a JSON Web Token without verifying its signature
+func decodeJWT(token string) (map[string]interface{}, error) {
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("JWT must have a header, claims and signature separated by dots")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("JWT claims are not base64url encoded")
+	}
+	val, err := parseJSON(string(payload))
+	claims, ok := val.(map[string]interface{})
+	if err != nil || !ok {
+		return nil, errors.New("JWT claims are not a JSON object")
+	}
+
+	return claims, nil
+
+}
@@ -1,21 +1,87 @@
 package dataapi
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/Celbux/dataapi/foundation/tools"
 	"github.com/Celbux/dataapi/foundation/web"
-	"github.com/japm/goScript"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// AddDuration will return the time with the duration added to it
+// Usage: [AddDuration(0, 1)]
+// Eg: [Set(expiry, [AddDuration([Now()], "24h")], time)]
+// Parameter 0: the time, a time or an RFC3339 string
+// Eg: [Now()]
+// Parameter 1: the duration to add, a negative duration subtracts it
+// Eg: "24h" or "-1h30m"
+func (d DataAPIService) AddDuration(t interface{}, duration interface{}) (Time, error) {
+
+	// Gets parameters 0 and 1
+	start, err := toTime(t)
+	if err != nil {
+		return Time{}, err
+	}
+	add, err := toDuration(duration)
+	if err != nil {
+		return Time{}, err
+	}
+
+	// Return the time
+	return Time{start.Add(add)}, nil
+
+}
+
+// Append will return a new list with the items added to the end of the list
+// Usage: [Append(0, 1...)]
+// Eg: [Set(vouchers, [Append(vouchers, "117-22427-719753")], list)]
+// Parameter 0: the list to add the items to
+// Eg: vouchers
+// Parameter 1++: the items to add
+// Eg: "117-22427-719753"
+func (d DataAPIService) Append(parameters []Node) interface{} {
+
+	// Gets parameter 0
+	if len(parameters) < 1 {
+		return errors.Errorf("Append expected at least 1 parameter but got: %v", len(parameters))
+	}
+	val, err := d.EvalNode(parameters[0])
+	if err != nil {
+		return err
+	}
+	list, err := toList(val)
+	if err != nil {
+		return err
+	}
+
+	// Copy the list so the original list is left unchanged
+	out := append([]interface{}{}, list...)
+	for _, parameter := range parameters[1:] {
+		item, err := d.EvalNode(parameter)
+		if err != nil {
+			return err
+		}
+		out = append(out, item)
+	}
+
+	// Return the new list
+	return out
+
+}
+
 // AssertContains will return an error if parameter 1 is not contained in parameter 0
 // Usage: [AssertContains(0, 1)]
 // Eg: [AssertContains("foobar", "bar")]
@@ -24,10 +90,9 @@ import (
 // Parameter 1: the element that is a subset of the string
 // Eg: "bar"
 // This will not throw an error as parameter 1 is contained in parameter 0
-func (d DataAPIService) AssertContains(params string) error {
+func (d DataAPIService) AssertContains(parameters []Node) error {
 
 	// Get parameters 0 and 1
-	parameters := d.GetParameters(params)
 	if len(parameters) != 2 {
 		return errors.Errorf("AssertContains expected 2 parameter but got: %v", len(parameters))
 	}
@@ -58,21 +123,41 @@ func (d DataAPIService) AssertContains(params string) error {
 // Parameter 1: value 2
 // Eg: "bar"
 // This will throw an error as parameter 0 is not equal to parameter 1
-func (d DataAPIService) AssertEquals(params string) error {
+// When either value is a decimal both values are compared exactly as numbers
+// Eg: [AssertEquals(before - amount, after)] passes for 20.00 - 5.5 and 14.5
+func (d DataAPIService) AssertEquals(parameters []Node) error {
 
 	// Get parameters 0 and 1
-	parameters := d.GetParameters(params)
 	if len(parameters) != 2 {
 		return errors.Errorf("AssertEquals expected 2 parameter but got: %v", len(parameters))
 	}
-	val1, err := d.EvalString(parameters[0])
+	raw1, err := d.EvalNode(parameters[0])
 	if err != nil {
 		return err
 	}
-	val2, err := d.EvalString(parameters[1])
+	raw2, err := d.EvalNode(parameters[1])
 	if err != nil {
 		return err
 	}
+	if raw1 == nil || raw2 == nil {
+		return errors.New("expression did not evaluate to a string")
+	}
+
+	// Decimals are compared exactly, so 20.00 equals 20
+	_, isDecimal1 := raw1.(Decimal)
+	_, isDecimal2 := raw2.(Decimal)
+	if isDecimal1 || isDecimal2 {
+		decimal1, err1 := toNumber(raw1, "decimal")
+		decimal2, err2 := toNumber(raw2, "decimal")
+		if err1 == nil && err2 == nil {
+			if decimal1.(Decimal).Cmp(decimal2.(Decimal)) != 0 {
+				return errors.Errorf("Expected %v but got %v", raw2, raw1)
+			}
+			return nil
+		}
+	}
+	val1 := fmt.Sprintf("%v", raw1)
+	val2 := fmt.Sprintf("%v", raw2)
 
 	// Remove all "\"
 	val1 = strings.Replace(val1, "\\", "", -1)
@@ -94,10 +179,9 @@ func (d DataAPIService) AssertEquals(params string) error {
 // Parameter 0: the error code that core returned
 // Eg: "-22"
 // This will throw an error if the error code from the last Core call is not -22
-func (d DataAPIService) AssertFailure(params string) error {
+func (d DataAPIService) AssertFailure(parameters []Node) error {
 
 	// Get parameter 0
-	parameters := d.GetParameters(params)
 	if len(parameters) != 1 {
 		return errors.Errorf("AssertEquals expected 1 parameter but got: %v", len(parameters))
 	}
@@ -107,11 +191,11 @@ func (d DataAPIService) AssertFailure(params string) error {
 	}
 
 	// Get the res field off the EvalCache to perform the error code check
-	res := d.EvalCache["res"].([]string)
-	if res == nil || len(res) == 0 {
-		return errors.New("res[] struct returned from core is empty")
+	res, err := d.response()
+	if err != nil {
+		return err
 	}
-	if res[0] != error {
+	if res.Success || res.Code != error {
 		return errors.Errorf("expected to fail with error: [%v] but got res: [%v]", error, res)
 	}
 
@@ -120,8 +204,31 @@ func (d DataAPIService) AssertFailure(params string) error {
 
 }
 
+// AssertMatches will ensure that a string matches a regular expression
+// Usage: [AssertMatches(0, 1)]
+// Eg: [AssertMatches(voucher, "^[0-9]{3}-[0-9]{5}-[0-9]{6}$")]
+// Parameter 0: the string to check
+// Eg: voucher
+// Parameter 1: the regular expression, use ^ and $ to match the whole string
+// Eg: "^[0-9]{3}-[0-9]{5}-[0-9]{6}$"
+func (d DataAPIService) AssertMatches(s string, re string) error {
+
+	// Ensure the string matches
+	matched, err := d.Match(s, re)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return errors.Errorf("expected %q to match %v", s, re)
+	}
+
+	// Return success
+	return nil
+
+}
+
 // AssertStringArrEquals will not error if the two input string arrays are equal
-// Given: [Set(a, "1,2,3", []string)] and [Set(b, "3,2,1", []string)]
+// Given: [Set(a, [1, 2, 3], []string)] and [Set(b, [3, 2, 1], []string)]
 // Usage: [AssertStringArrEquals(0, 1, 2)]
 // Eg: [AssertStringArrEquals(a, b, true)]
 // Parameter 0: the first array to compare
@@ -130,24 +237,31 @@ func (d DataAPIService) AssertFailure(params string) error {
 // Eg: b
 // Parameter 2: a boolean to determine whether order matters or not
 // Eg: true
+// The arrays can be lists, JSON arrays or strings delimited by "___"
+// Items are compared by their printed values
 // This will not throw an error as order doesn't matter and the arrays are therefore equal
-func (d DataAPIService) AssertStringArrEquals(params string) error {
+func (d DataAPIService) AssertStringArrEquals(parameters []Node) error {
 
 	// Get parameters 0, 1 and 2
-	parameters := d.GetParameters(params)
 	if len(parameters) != 3 {
 		return errors.Errorf("AssertStringArrEquals expected 3 parameters but got: %v", len(parameters))
 	}
-	aRaw, err := d.EvalString(parameters[0])
+	aRaw, err := d.EvalNode(parameters[0])
 	if err != nil {
 		return err
 	}
-	a := strings.Split(aRaw, "___")
-	bRaw, err := d.EvalString(parameters[1])
+	a, err := toStrings(aRaw)
+	if err != nil {
+		return err
+	}
+	bRaw, err := d.EvalNode(parameters[1])
+	if err != nil {
+		return err
+	}
+	b, err := toStrings(bRaw)
 	if err != nil {
 		return err
 	}
-	b := strings.Split(bRaw, "___")
 	orderMatters, err := d.EvalBool(parameters[2])
 	if err != nil {
 		return err
@@ -194,16 +308,12 @@ func (d DataAPIService) AssertStringArrEquals(params string) error {
 func (d DataAPIService) AssertSuccess() error {
 
 	// Get the response of the EvalCache and ensure no error code is present
-	res, ok := d.EvalCache["res"].([]string)
-	_, ok2 := d.EvalCache["res"].(map[string]interface{})
-	d.EvalCache["res"] = nil
-	if !ok && !ok2 {
-		return errors.New("could not convert EvalCache[\"res\"] to a supported type")
-	}
-	if res == nil || len(res) == 0 {
-		return errors.New("res[] struct returned from core is empty")
+	res, err := d.response()
+	d.scope().Set("res", nil)
+	if err != nil {
+		return err
 	}
-	if strings.HasPrefix(res[0], "-") {
+	if !res.Success {
 		return errors.Errorf("expected success but failed with core res[]: %v", res)
 	}
 
@@ -212,6 +322,158 @@ func (d DataAPIService) AssertSuccess() error {
 
 }
 
+// AssertWithin will ensure that two times are at most a duration apart
+// Usage: [AssertWithin(0, 1, 2)]
+// Eg: [AssertWithin(body.CreatedDT, [Now()], "5s")]
+// Parameter 0: the first time, a time or an RFC3339 string
+// Eg: body.CreatedDT
+// Parameter 1: the second time, a time or an RFC3339 string
+// Eg: [Now()]
+// Parameter 2: the largest difference allowed between the times
+// Eg: "5s"
+func (d DataAPIService) AssertWithin(t1 interface{}, t2 interface{}, duration interface{}) error {
+
+	// Gets parameters 0, 1 and 2
+	a, err := toTime(t1)
+	if err != nil {
+		return err
+	}
+	b, err := toTime(t2)
+	if err != nil {
+		return err
+	}
+	within, err := toDuration(duration)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the difference between the times is within the duration
+	difference := a.Sub(b.Time)
+	if difference < 0 {
+		difference = -difference
+	}
+	if difference > within {
+		return errors.Errorf("expected %v to be within %v of %v but it was %v apart", a, within, b, difference)
+	}
+
+	// Return success
+	return nil
+
+}
+
+// Base64Decode will return the string held in base64
+// Usage: [Base64Decode(0)]
+// Eg: [Set(payload, [Base64Decode(body.Payload)], json)]
+// Parameter 0: standard or URL safe base64, with or without padding
+// Eg: "aGVsbG8gd29ybGQ="
+func (d DataAPIService) Base64Decode(s string) (string, error) {
+
+	b, err := decodeBase64(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+
+}
+
+// Base64Encode will return the string encoded in base64
+// Usage: [Base64Encode(0)] or [Base64Encode(0, 1)]
+// Eg: [Set(headers, ["Authorization: Basic {{[Base64Encode(\"user:pass\")]}}"], list)]
+// Parameter 0: the string to encode
+// Eg: "user:pass"
+// Parameter 1: optional, true to use URL safe base64 without padding as used in JWTs
+// Eg: true
+func (d DataAPIService) Base64Encode(s string, urlSafe bool) string {
+	if urlSafe {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// Break will stop the For or While loop it is called in
+// Usage: [Break()]
+// Eg: [For(i < 10, [If(i == 3, [Break()])][Set(i, i+1, int)])]
+// The loop will stop once i reaches 3
+func (d DataAPIService) Break() error {
+	return &Signal{Kind: SignalBreak}
+}
+
+// Check will find problems in the data code of the given file without running it
+// Usage: [Check(0)]
+// Eg: [AssertEquals([Len([Check("test_payments.txt")])], 0)]
+// Parameter 0: the name of the file or directory to check, relative to configs/dataapi
+// Eg: "test_payments.txt"
+// The following problems are returned, each prefixed with the position of the problem:
+// > syntax errors, such as unbalanced brackets
+// > data functions that do not exist or are called with the wrong number of parameters
+// > Set types that do not exist
+// > variables that are used before they are set
+// > Evaluate, Import and ReadFile targets that can not be read
+// No data function is run, so no requests are sent and no variables are set
+func (d DataAPIService) Check(inFile string) []string {
+
+	c := &checker{d: d, seen: map[string]bool{}, imports: map[string]*checkScope{}}
+	c.checkFile(inFile, c.root())
+
+	// Return the problems
+	return c.problems
+
+}
+
+// Contains will return true if a list contains an item or a string contains a substring
+// Usage: [Contains(0, 1)]
+// Eg: [If([Contains(vouchers, "117-22427-719752")], [PrintF("Found")])]
+// Parameter 0: the list or string to search
+// Eg: vouchers
+// Parameter 1: the item or substring to search for
+// Eg: "117-22427-719752"
+func (d DataAPIService) Contains(parameters []Node) interface{} {
+
+	// Gets parameters 0 and 1
+	if len(parameters) != 2 {
+		return errors.Errorf("Contains expected 2 parameters but got: %v", len(parameters))
+	}
+	collection, err := d.EvalNode(parameters[0])
+	if err != nil {
+		return err
+	}
+	item, err := d.EvalNode(parameters[1])
+	if err != nil {
+		return err
+	}
+
+	// A string is searched for the substring
+	if s, ok := collection.(string); ok {
+		return strings.Contains(s, fmt.Sprintf("%v", item))
+	}
+
+	// A list is searched for an item that is equal to the item
+	list, err := toList(collection)
+	if err != nil {
+		return err
+	}
+	for _, val := range list {
+		equal, err := binaryOp("==", val, item)
+		if boolean, _ := equal.(bool); boolean && err == nil {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Continue will skip the rest of the current iteration of the For or While loop it is called in
+// Usage: [Continue()]
+// Eg: [For(i < 3, [Set(i, i+1, int)][If(i == 2, [Continue()])][PrintF("%v", i)])]
+// This for loop will output:
+// > 1
+// > 3
+func (d DataAPIService) Continue() error {
+	return &Signal{Kind: SignalContinue}
+}
+
 // DirectoryExists returns true if the directory exists
 func (d DataAPIService) DirectoryExists(path string) bool {
 	_, err := os.Stat(path)
@@ -221,118 +483,72 @@ func (d DataAPIService) DirectoryExists(path string) bool {
 	return true
 }
 
-// Eval will execute the data code expression given
-// Eg data code: [Set(s, "Hello World!", string)][PrintF("%v", s)]
-// This string input will evaluate to printing "Hello World!" to the console
-func (d DataAPIService) Eval(expression string) (map[string]interface{}, error) {
-
-	// Create return map
-	out := make(map[string]interface{})
+// Env will return the value of an environment variable of the Data API process
+// Usage: [Env(0)] or [Env(0, 1)]
+// Eg: [Set(url, "{{[Env(\"CORE_URL\")]}}/pay", string)]
+// Parameter 0: the name of the environment variable
+// Eg: "CORE_URL"
+// Parameter 1: optional, the value returned when the environment variable is not set
+// Eg: "http://localhost:8080"
+// Env fails when the environment variable is not set and there is no default, use Secret for tokens and passwords
+func (d DataAPIService) Env(name string, def *string) (string, error) {
 
-	// Get all expressions
-	// There could be more than 1 data block given and thus
-	// would have to be evaluated individually in a for loop
-	var allErrors []error
-	expressionsRaw := d.GetExpressions(expression)
-	for i, rawExpression := range expressionsRaw {
-		var method string
-		var params string
-		expression = rawExpression
-		if strings.Contains(rawExpression, "[") && strings.Contains(rawExpression, "]") {
-			// Get method names and prepare parameters on the EvalCache
-			// if the expression contains a Functions call
-			var err error
-			method, params, err = d.GetFunctionDefinition(rawExpression)
-			if err != nil {
-				allErrors = append(allErrors, err)
-				continue
-			}
-			d.EvalCache["params"] = params
-			expression = method + "(params)"
-			if len(params) == 0 {
-				expression = method + "()"
-			}
-		}
+	value, ok := os.LookupEnv(name)
+	if !ok && def == nil {
+		return "", errors.Errorf("environment variable %v is not set", name)
+	}
+	if !ok {
+		return *def, nil
+	}
 
-		// Prepare expression struct and execute the expression using the EvalCache
-		// The EvalCache is the only available variables in the scope of the evaluation function
-		exp := &goScript.Expr{}
-		err := exp.Prepare(expression)
-		if err != nil {
-			allErrors = append(allErrors, err)
-			continue
-		}
+	return value, nil
 
-		// Set newMap, as exp.Eval will break if the map is not a new pointer
-		newMap := make(map[string]interface{})
-		newMap = d.EvalCache
+}
 
-		// Eval the expression
-		// All functions that ran to completion and did not throw an error will pass
-		// The report tree will prune out the success and failures from the tree last
-		val, err := exp.Eval(newMap)
-		if err != nil {
-			method, _, _ := d.GetFunctionDefinition(rawExpression)
-			methodNotFound := tools.StripField(err.Error(), "Method (.*) not found")
-			if methodNotFound == strings.Replace(method, "dataapi.", "", 1) {
-				expression = strings.Replace(expression, "dataapi", "dataapi.CoreDataAPI", 1)
-				exp := &goScript.Expr{}
-				err := exp.Prepare(expression)
-				if err != nil {
-					allErrors = append(allErrors, err)
-					continue
-				}
-				val, err = exp.Eval(newMap)
-				if err != nil {
-					allErrors = append(allErrors, err)
-					continue
-				}
-			} else {
-				allErrors = append(allErrors, err)
-				continue
-			}
-		}
-		if val == nil && i == len(expressionsRaw) - 1 {
-			return nil, errors.New("[Pass()]")
-		}
+// Eval will execute the data code expression given
+// Eg data code: [Set(s, "Hello World!", string)][PrintF("%v", s)]
+// This string input will evaluate to printing "Hello World!" to the console
+func (d DataAPIService) Eval(ctx context.Context, expression string) (map[string]interface{}, error) {
 
-		// Handle the returned data that was returned from Eval
-		// This could be a primitive or a report tree
-		switch val.(type) {
-		case map[string]interface{}:
-			// Check for cascading results, and return them to Evaluate from Eval
-			// All failures/successes will be evaluated into a report tree
-			// We don't want to fail the evaluate process immediately
-			res := val.(map[string]interface{})
-			_, ok := res["report"].(*tools.Tree)
-			if ok {
-				return res, nil
-			}
-		case error:
-			// If there is an error append it and continue
-			allErrors = append(allErrors, val.(error))
-			continue
-		default:
-			// Used for eval of single return values
-			out["val"] = fmt.Sprintf("%v", val)
-		}
+	// Start a new run if this is the first expression to be evaluated
+	// The expression stops when the context is cancelled
+	d = d.withRun().withContext(ctx)
 
+	// Parse the expression into an AST
+	// There could be more than 1 data block given and thus
+	// would be parsed into a block that evaluates each call individually
+	node, err := ParseExpression("", expression)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(allErrors) > 0 {
-		errString := ""
-		for _, err := range allErrors {
-			if err.Error() == "[Pass()]" {
-				continue
-			}
-			errString += fmt.Sprintf("%v, ", err.Error())
-		}
-		if errString == "" {
-			errString = "[Pass()]"
+	// Eval the expression
+	// Return stops the expression early with the value it was given
+	// Secrets are redacted from the failure
+	val, err := d.EvalNode(node)
+	if signal, ok := err.(*Signal); ok && signal.Kind == SignalReturn {
+		val, err = signal.Value, nil
+	}
+	if err != nil {
+		return nil, d.Run.redactError(err)
+	}
+
+	// Handle the returned data that was returned from Eval
+	// This could be a primitive or a report tree
+	res, ok := val.(map[string]interface{})
+	if ok {
+		// Check for cascading results, and return them to Evaluate from Eval
+		// All failures/successes will be evaluated into a report tree
+		// We don't want to fail the evaluate process immediately
+		if _, ok := res["report"].(*tools.Tree); ok {
+			return res, nil
 		}
-		return nil, errors.New(errString)
 	}
 
+	// Used for eval of single return values
+	out := make(map[string]interface{})
+	out["val"] = val
+
 	// Return success
 	return out, nil
 
@@ -340,7 +556,7 @@ func (d DataAPIService) Eval(expression string) (map[string]interface{}, error)
 
 // Evaluate is a data function that runs all test data code inside a dataApi tests file
 // It takes in the test file name to run as input
-// Each line in the input file gets evaluated and all errors arr built up into a tree
+// Each statement in the input file gets evaluated and all errors arr built up into a tree
 // The tree is used to store which test failed and which tests passed
 // and is return as the result of a Data API run
 // You can call Evaluate on a directory or a file
@@ -348,37 +564,46 @@ func (d DataAPIService) Eval(expression string) (map[string]interface{}, error)
 // Eg: [Evaluate("cascadingerrors")]
 // Parameter 0: The directory or test case file you want to run
 // Eg: "cascadingerrors"
-func (d DataAPIService) Evaluate(inFile string) map[string]interface{} {
+// Named parameters that follow are set as variables in the scope of the file, see Params
+// Eg: [Evaluate("payments/pay.txt", storeID="Store1", amount=2000)]
+// A file can limit how long it runs for with a [Timeout(seconds)] header, see Timeout
+// Evaluating stops when the context is cancelled, the code that was cut short is marked as timed out in the report
+func (d DataAPIService) Evaluate(ctx context.Context, inFile string) map[string]interface{} {
+	return d.EvaluateWith(ctx, inFile, nil)
+}
 
-	// Log file to track which test is currently running
+// EvaluateWith will run all test data code inside a dataApi tests file with the given named parameters
+// The parameters are set as variables in the scope of the file before it runs
+// When the file is a directory every file in it is run with the parameters
+func (d DataAPIService) EvaluateWith(ctx context.Context, inFile string, args []Argument) map[string]interface{} {
+
+	// Start a new run if this is the first file to be evaluated
+	// Log file to track which test is currently running, once the logger of the run redacts its secrets
+	d = d.withRun().withContext(ctx)
 	d.Log.Println(inFile)
 
 	// Evaluate can not fail and always returns a report
 	// Any error will be associated with the file name that is being Evaluated
 	// Eg: tree["someTest.txt"] = "error: some function failed"
+	// The parameters are added to the name of the file so that runs with different parameters can be told apart
+	// Eg: configs/dataapi/payments/pay.txt(storeID=Store1, amount=2000)
 	out := make(map[string]interface{})
-	report := &tools.Tree{Data: inFile}
-	out["report"] = report
-
-	// The file name will be evaluated so ensure it is in quotations
-	if inFile[0] != '"' && inFile[len(inFile)-1] != '"' {
-		inFile = "\"" + inFile + "\""
-	}
-	inFile, err := d.EvalString(inFile)
-	if err != nil && err.Error() != "[Pass()]" {
-		report.Add(inFile, err.Error())
-		return out
-	}
 	filepath := "configs/dataapi/" + inFile
-	report.Data = filepath
+	// The seed of the run is returned so that a failing run can be replayed with the same random data
+	// Secrets are redacted from the report once the file has run
+	report := &tools.Tree{Data: filepath + describeArgs(args)}
+	out["report"] = report
+	out["seed"] = d.Run.Seed
+	defer d.Run.redactTree(report)
 
-	// Read the file contents line by line into s.Functions.Eval
+	// Read the file contents into the parser
 	osFile, err := os.OpenFile(filepath, os.O_RDONLY, 0644)
 	if err != nil {
-		report.Add(filepath, "could not open file")
+		report.Add(report.Data, "could not open file")
 		report.Add("could not open file", err.Error())
 		return out
 	}
+	defer osFile.Close()
 	var dataRawArr [][]byte
 	dataRaw, err := ioutil.ReadAll(osFile)
 	if err == nil && dataRaw != nil {
@@ -390,16 +615,16 @@ func (d DataAPIService) Evaluate(inFile string) map[string]interface{} {
 		if d.DirectoryExists(filepath) {
 			files, err := ioutil.ReadDir(filepath)
 			if err != nil {
-				report.Add(filepath, err.Error())
+				report.Add(report.Data, err.Error())
 				return out
 			}
 
 			for _, file := range files {
 				filepathNested := inFile + "/" + file.Name()
-				reportRaw := d.Evaluate(filepathNested)
+				reportRaw := d.EvaluateWith(ctx, filepathNested, args)
 				err, ok := reportRaw["err"].(error)
 				if ok {
-					report.Add(filepath, filepathNested)
+					report.Add(report.Data, filepathNested)
 					report.Add(filepathNested, err.Error())
 					continue
 				}
@@ -408,12 +633,11 @@ func (d DataAPIService) Evaluate(inFile string) map[string]interface{} {
 					case *tools.Tree:
 						reportReturned, ok := reportRaw["report"].(*tools.Tree)
 						if !ok {
-							report.Add(filepath, filepathNested)
+							report.Add(report.Data, filepathNested)
 							report.Add(filepathNested, "report returned but is not a tree")
 							continue
 						}
-						report.Add(filepath, reportReturned.Data)
-						report.AddTree(*reportReturned)
+						report.AddNode(reportReturned)
 						continue
 					}
 				}
@@ -423,40 +647,73 @@ func (d DataAPIService) Evaluate(inFile string) map[string]interface{} {
 	}
 	// If the input file contains no data, throw an error
 	if len(dataRawArr) == 0 {
-		report.Add(filepath, "there is no data in the input file to evaluate")
+		report.Add(report.Data, "there is no data in the input file to evaluate")
 		return out
 	}
 
-	// Loop over every line in the input file
+	// The file runs in its own scope layered over the scope of the caller
+	// Variables set in the file are not visible to the caller unless they are exported
+	// The named parameters are the first variables of the scope
+	d.Scope = NewScope(d.scope())
+	d.Scope.args = make(map[string]bool)
+	for _, arg := range args {
+		d.Scope.Define(arg.Name, arg.Value)
+		d.Scope.args[arg.Name] = true
+	}
+
+	// Loop over every statement in the input file
 	// Add all calls and the data they returned to the report
 	// This will be used to create the failures and success report lastly
+statements:
 	for _, rawData := range dataRawArr {
-		data := strings.Split(string(rawData), "\n")
-		for _, datum := range data {
-			if len(datum) == 0 || datum[0] == '#' || strings.TrimSpace(datum) == "" {
+		script := ParseScript(filepath, string(rawData))
+		for _, statement := range script.Statements {
+			node := reportNode(statement)
+			// A Timeout header limits how long the rest of the file may run for
+			if header, ok := statement.(*Call); ok && header.Name == "Timeout" && len(header.Args) == 1 {
+				limit, err := d.evalSeconds(header.Args[0])
+				if err != nil {
+					addFailure(node, err)
+					report.AddNode(node)
+					continue
+				}
+				var cancel context.CancelFunc
+				d, cancel = d.withTimeout(limit)
+				defer cancel()
+				addPass(node, nil)
+				report.AddNode(node)
 				continue
 			}
-
-			reportRaw, err := d.Eval(datum)
+			val, err := d.EvalNode(statement)
+			if signal, ok := err.(*Signal); ok && signal.Kind == SignalReturn {
+				// Return stops evaluating the rest of the file
+				node.AddNode(&tools.Tree{Data: "[Pass()]"})
+				report.AddNode(node)
+				break statements
+			}
 			if err != nil {
-				report.Add(filepath, datum)
-				report.Add(datum, err.Error())
+				// The file can not run without the parameters it declared
+				addFailure(node, err)
+				report.AddNode(node)
+				if call, ok := statement.(*Call); ok && call.Name == "Params" {
+					break statements
+				}
+				// Nothing else can run once the run has reached its limit of evaluated expressions or timed out
+				if d.exhausted() || d.done() != nil {
+					break statements
+				}
 				continue
 			}
-			if reportRaw != nil {
-				switch reportRaw["report"].(type) {
-				case *tools.Tree:
-					reportReturned, ok := reportRaw["report"].(*tools.Tree)
-					if !ok {
-						report.Add(filepath, datum)
-						report.Add(datum, "report returned but is not a tree")
-						continue
-					}
-					report.Add(filepath, reportReturned.Data)
-					report.AddTree(*reportReturned)
+			reportRaw, ok := val.(map[string]interface{})
+			if ok {
+				reportReturned, ok := reportRaw["report"].(*tools.Tree)
+				if ok {
+					report.AddNode(reportReturned)
 					continue
 				}
 			}
+			addPass(node, val)
+			report.AddNode(node)
 		}
 	}
 
@@ -466,242 +723,469 @@ func (d DataAPIService) Evaluate(inFile string) map[string]interface{} {
 }
 
 // EvalBool returns the boolean value the expression returned
-func (d DataAPIService) EvalBool(expression string) (bool, error) {
+func (d DataAPIService) EvalBool(expression Node) (bool, error) {
 
 	// Evaluate the expression
-	res, err := d.Eval(expression)
+	val, err := d.EvalNode(expression)
 	if err != nil {
 		return false, err
 	}
 
-	// Ensure a value was returned
-	booleanRaw, ok := res["val"]
+	// Ensure the returned value is in fact a boolean
+	boolean, ok := toBool(val)
 	if !ok {
 		return false, errors.New("expression did not evaluate to a boolean")
 	}
 
-	// Ensure the returned value is in fact a boolean
-	boolean, err := strconv.ParseBool(booleanRaw.(string))
-	if err != nil || !ok {
-		return false, err
-	}
-
 	return boolean, nil
 
 }
 
 // EvalInt returns the int value the expression returned
-func (d DataAPIService) EvalInt(expression string) (int, error) {
+func (d DataAPIService) EvalInt(expression Node) (int, error) {
 
 	// Evaluate the expression
-	res, err := d.Eval(expression)
+	val, err := d.EvalNode(expression)
 	if err != nil {
 		return 0, err
 	}
 
-	// Ensure a value was returned
-	intRaw, ok := res["val"]
+	// Ensure the returned value is in fact an int
+	i, ok := toInt(val)
 	if !ok {
 		return 0, errors.New("expression did not evaluate to an int")
 	}
 
-	// Ensure the returned value is in fact an int
-	intVal, err := strconv.Atoi(intRaw.(string))
-	if err != nil {
-		return 0, err
+	return i, nil
+
+}
+
+// EvalNode evaluates a parsed data code node and returns the resulting value
+// Calls run their data function, identifiers are looked up on the EvalCache
+// and operators are applied to their evaluated operands
+func (d DataAPIService) EvalNode(expression Node) (interface{}, error) {
+
+	// Every expression counts against the limit of the run
+	if err := d.step(); err != nil {
+		return nil, err
+	}
+
+	switch expression := expression.(type) {
+	case *BasicLit:
+		return expression.Value, nil
+	case *Ident:
+		val, ok := d.scope().Get(expression.Name)
+		if !ok {
+			return nil, errors.Errorf("variable %v is not defined", expression.Name)
+		}
+		return val, nil
+	case *UnaryExpr:
+		return d.evalUnary(expression)
+	case *BinaryExpr:
+		return d.evalBinary(expression)
+	case *Call:
+		val, err := d.call(expression)
+		if _, ok := err.(*Signal); ok {
+			return nil, err
+		}
+		if err != nil {
+			return nil, &EvalError{Pos: expression.Pos(), Call: expression.String(), Err: err}
+		}
+		return val, nil
+	case *Block:
+		return d.evalBlock(expression)
+	case *Template:
+		return d.evalTemplate(expression)
+	case *Tuple:
+		return d.evalItems(expression.Items)
+	case *List:
+		return d.evalItems(expression.Items)
+	case *Index:
+		x, err := d.EvalNode(expression.X)
+		if err != nil {
+			return nil, err
+		}
+		i, err := d.EvalNode(expression.Index)
+		if err != nil {
+			return nil, err
+		}
+		return index(x, i)
+	case *Selector:
+		x, err := d.EvalNode(expression.X)
+		if err != nil {
+			return nil, err
+		}
+		return index(x, expression.Name)
+	case *NamedArg:
+		return nil, errors.Errorf("named parameter %v can only be given to a data function", expression)
+	case *BadNode:
+		return nil, expression.Err
 	}
 
-	return intVal, nil
+	return nil, errors.Errorf("unable to evaluate expression %v", expression)
 
 }
 
 // EvalString returns the string value the expression returned
-func (d DataAPIService) EvalString(expression string) (string, error) {
+func (d DataAPIService) EvalString(expression Node) (string, error) {
 
 	// Evaluate the expression
-	res, err := d.Eval(expression)
+	val, err := d.EvalNode(expression)
 	if err != nil {
 		return "", err
 	}
 
 	// Ensure a value was returned
-	stringRaw, ok := res["val"]
-	if !ok {
+	if val == nil {
 		return "", errors.New("expression did not evaluate to a string")
 	}
 
-	return stringRaw.(string), nil
-
-}
+	return fmt.Sprintf("%v", val), nil
 
-// Fail will return the given string as an error
-func (d DataAPIService) Fail(err string) error {
-	return errors.New(err)
 }
 
-// For is just like your normal for loop:
-// Usage: [For(0, 1)]
-// Eg: [For((i < 3), [PrintF("Hello World %v", i)][Set(i,i+1,int)])]
-// Parameter 0: is the condition that will break the loop
-// Eg: (i < size)
-// Parameter 1: is the code that runs inside the for loop
-// Eg: [PrintF("Hello World %v", i)][Set(i,i+1,int)]
-// This for loop will output:
-// > Hello World 0
-// > Hello World 1
-// > Hello World 2
-func (d DataAPIService) For(params string) interface{} {
+// ExpectFail will run the code in parameter 0 and only pass if the code fails with a matching error
+// Usage: [ExpectFail(0, 1)]
+// Eg: [ExpectFail([AssertEquals(1, 2)], "Expected 2 but got 1")]
+// Eg: [ExpectFail([ReadFile("missing", "configs/dataapi/missing.txt")], "no such file")]
+// Parameter 0: the code that is expected to fail
+// Eg: [AssertEquals(1, 2)]
+// Parameter 1: a substring of the expected error or a regular expression that matches it
+// Eg: "Expected 2 but got 1" or "Expected [0-9]+"
+// This will not throw an error as the code in parameter 0 fails with the expected error
+func (d DataAPIService) ExpectFail(parameters []Node) interface{} {
 
 	// Gets parameters 0 and 1
-	expressions := d.GetParameters(params)
-	if len(expressions) != 2 {
-		return errors.Errorf("for loop expected 2 expressions but got: %v", len(expressions))
+	if len(parameters) != 2 {
+		return errors.Errorf("ExpectFail expected 2 parameters but got: %v", len(parameters))
+	}
+	expected, err := d.EvalString(parameters[1])
+	if err != nil {
+		return err
 	}
 
-	for {
-		// Run the first expression to see if it returns true or false
-		boolean, err := d.EvalBool(expressions[0])
-		if err != nil {
-			return err
-		}
-
-		// If false, break the loop
-		if !boolean {
-			break
-		}
-
-		// If true, run the expression in parameter 2
-		_, err = d.Eval(expressions[1])
-		if err != nil && err.Error() != "[Pass()]"{
-			return err
-		}
+	// Run the code and ensure it failed
+	_, err = d.EvalNode(parameters[0])
+	if _, ok := err.(*Signal); ok {
+		return err
+	}
+	if err == nil {
+		return errors.Errorf("expected %v to fail with \"%v\" but it passed", parameters[0], expected)
 	}
 
-	// Return success
-	return errors.New("[Pass()]")
-
-}
-
-// GetExpressions retrieves all expressions nested on the same scope level
-// This is equivalent to splitting each line of code like java does with semi colons
-// Eg: 	expressions([Set(i,1,int)][Set(i,[GetSomeVar()],i,int)][Set(j,3,string)])
-// Will split into: [Set(i,1,int)]	[Set(i,[GetSomeVar()],i,int)]	[Set(j,3,string)]
-// And return: []string = {
-//		"[Set(i,1,int)]",
-//		"[Set(i,[GetSomeVar()],i,int)]",
-//		"[Set(j,3,string)]",
-// }
-func (d DataAPIService) GetExpressions(expressions string) []string {
-
-	var out []string
-	// If the expression does not contain '[' or ']'
-	// then we can directly evaluate it as it is not a Functions call
-	// Eg: (i <= 10) versus [Set(Val, i <= 10, bool)]
-	// The first instance will set the 'res' variable by default on the EvalCache
-	// The second instance will call Set() and  set the 'Val' variable on the EvalCache
-	// Both instances set the value to the evaluated result of i <= 10
-	if !strings.Contains(expressions, "[") && !strings.Contains(expressions, "]") {
-		return append(out, expressions)
-	}
-
-	// Get all the expressions and put them into []string
-	scope := 0
-	start := strings.Index(expressions, "[")
-	for i, char := range expressions {
-		letter := string(char)
-		if letter == "[" {
-			scope++
-		} else if letter == "]" {
-			scope--
-			if scope == 0 {
-				out = append(out, expressions[start:i+1])
-				start = i + 1
-			}
-		}
+	// Ensure the error contains or matches the expected error
+	if !matches(err.Error(), expected) {
+		return errors.Errorf("expected %v to fail with \"%v\" but it failed with: %v", parameters[0], expected, err)
 	}
 
-	// Return the expressions
-	return out
+	// Return success
+	return nil
 
 }
 
-// GetFunctionDefinition will separate the function name and parameter list
-// Input:
-// > expression = [PrintF("Hello World %v", i)]
-// Output:
-// > method = dataapi.PrintF
-// > params = ("Hello World %v", i)
-// > err = nil
-func (d DataAPIService) GetFunctionDefinition(expression string) (string, string, error) {
-
-	// Get indexes of '[', ']' and '(', ')'
-	// to slice the method name and parameter list respectively
-	scope := 0
-	start := 0
-	end := 0
-	for i, letter := range expression {
-		if letter == '[' {
-			scope++
-			if scope == 1 {
-				start = i
-			}
-		} else if letter == ']' {
-			scope--
-		}
-		if scope == 0 {
-			end = i
-			break
-		}
+// Export will make variables of the current file available to the file that Evaluated it
+// Usage: [Export(0, 1...)]
+// Eg: [Export(token)]
+// Parameter 0++: the names of the variables to export
+// Eg: token
+// Once the file has been evaluated, token can be used by the caller:
+// > [Evaluate("login.txt")][PrintF("%v", token)]
+func (d DataAPIService) Export(parameters []Node) interface{} {
+
+	// Gets parameters 0, 1...
+	if len(parameters) == 0 {
+		return errors.Errorf("Export expected atleast 1 parameter but got: %v", len(parameters))
 	}
-	if end == 0 || start >= end {
-		return "", "", errors.New("unable to evaluate expression")
-	}
-	exp := expression[start+1 : end]
-	index := strings.Index(exp, "(")
-	if index == -1 {
-		return "", "", errors.New("can not find '(' in the expression")
-	}
-	method := "dataapi." + exp[:index]
-	params := exp[index:]
-	params = strings.TrimLeft(params, "(")
-	params = strings.TrimRight(params, ")")
-
-	return method, params, nil
-
-}
-
-// GetParameters retrieves all the parameters seperated by a comma
-// Eg: [For([Set(i,0,int)],[Bool(i < 10)],[Set(i,0,int)],[doWork()])]
-// The expression must return all parameters delimited by the top most comma delimitation
-// Therefore: [For([Set(i,0,int)]	,	[Bool(i < 10)]	,	[Set(i,0,int)]	,	[doWork()])]
-// Top most commas:					^					^					^
-// Return: []string = {
-//		"[Set(i,0,int)]",
-//		"[Bool(i < 10)]",
-//		"[Set(i,0,int)]",
-//		"[doWork()]"
-// }
-func (d DataAPIService) GetParameters(expression string) []string {
-
-	// Get all parameters and put them in []string
-	var out []string
-	scope := 0
-	start := 0
-	for i, char := range expression {
-		letter := string(char)
-		if letter == "[" {
-			scope++
-		} else if letter == "]" {
-			scope--
-		} else if letter == "," && scope == 0 {
-			out = append(out, expression[start:i])
-			start = i + 1
+
+	// Set every variable on the scope of the caller
+	for _, parameter := range parameters {
+		variable := strings.TrimSpace(parameter.String())
+		if !d.scope().Export(variable) {
+			return errors.Errorf("variable %v is not defined", variable)
 		}
 	}
-	out = append(out, expression[start:])
 
-	// Return all the parameters
-	return out
+	// Return success
+	return nil
+
+}
+
+// Extract will return the part of a string captured by a group of a regular expression
+// Usage: [Extract(0, 1)] or [Extract(0, 1, 2)]
+// Eg: [Set(voucher, [Extract(res, "Voucher ([0-9-]+) issued")], string)]
+// Parameter 0: the string to search
+// Eg: res
+// Parameter 1: the regular expression
+// Eg: "Voucher ([0-9-]+) issued"
+// Parameter 2: optional, the number of the group, 0 is the whole match and a negative number uses the default
+// Eg: 1
+// The first group is used by default, or the whole match when the regular expression has no groups
+// Extract fails if the string does not match
+func (d DataAPIService) Extract(s string, re string, group int) (string, error) {
+
+	// Find the groups of the first match
+	r, err := compileRegexp(re)
+	if err != nil {
+		return "", err
+	}
+	if group < 0 && r.NumSubexp() > 0 {
+		group = 1
+	} else if group < 0 {
+		group = 0
+	}
+	if group > r.NumSubexp() {
+		return "", errors.Errorf("%v has no group %v", re, group)
+	}
+	groups := r.FindStringSubmatch(s)
+	if groups == nil {
+		return "", errors.Errorf("%q does not match %v", s, re)
+	}
+
+	// Return the group
+	return groups[group], nil
+
+}
+
+// Fail will return the given string as an error
+func (d DataAPIService) Fail(err string) error {
+	return errors.New(err)
+}
+
+// Format will return the formatted string, just like fmt.Sprintf
+// Usage: [Format(0, 1...)]
+// Eg: [Set(reference, [Format("REF-%06d", [Sequence("reference")])], string)]
+// Parameter 0: the format
+// Eg: "REF-%06d"
+// Parameter 1++: the values to format
+// Eg: 1
+// The above will return REF-000001
+func (d DataAPIService) Format(format string, values []interface{}) string {
+	return fmt.Sprintf(format, values...)
+}
+
+// FormatTime will return the time formatted with the layout
+// Usage: [FormatTime(0, 1)]
+// Eg: [Set(requestDT, [FormatTime([Now()], "DateTime")], string)]
+// Parameter 0: the time, a time or an RFC3339 string
+// Eg: [Now()]
+// Parameter 1: a Go time layout or one of RFC3339, RFC3339Nano, RFC1123, RFC1123Z, RFC822, ANSIC, DateTime,
+// Date, Time, unix or unixmilli
+// Eg: "DateTime" or "02/01/2006 15:04"
+func (d DataAPIService) FormatTime(t interface{}, layout string) (string, error) {
+
+	// Gets parameter 0
+	formatted, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+
+	// Return the formatted time
+	return formatTime(formatted, layout), nil
+
+}
+
+// For is just like your normal for loop:
+// Usage: [For(0, 1)]
+// Eg: [For((i < 3), [PrintF("Hello World %v", i)][Set(i,i+1,int)])]
+// Parameter 0: is the condition that will break the loop
+// Eg: (i < size)
+// Parameter 1: is the code that runs inside the for loop
+// Eg: [PrintF("Hello World %v", i)][Set(i,i+1,int)]
+// [Break()] and [Continue()] can be used inside the code to stop the loop or move to the next iteration
+// The loop fails once it has run the maximum number of iterations a loop may run, which is 10000 by default
+// This for loop will output:
+// > Hello World 0
+// > Hello World 1
+// > Hello World 2
+func (d DataAPIService) For(parameters []Node) interface{} {
+
+	// Gets parameters 0 and 1
+	if len(parameters) != 2 {
+		return errors.Errorf("for loop expected 2 expressions but got: %v", len(parameters))
+	}
+
+	// Run the expression in parameter 1 until parameter 0 returns false
+	// Every iteration runs in a new block scope
+	err := d.loop("For", parameters[0], parameters[1])
+	if err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+
+}
+
+// ForEach will run the code in the last parameter once for every item in a collection
+// Usage: [ForEach(0, 1, 2)] or [ForEach(0, 1, 2, 3)]
+// Eg: [ForEach(voucher, vouchers, [PrintF("%v", voucher)])]
+// Eg: [ForEach(i, voucher, vouchers, [PrintF("%v: %v", i, voucher)])]
+// Parameter 0: optional, the variable that holds the index of the current item
+// Eg: i
+// Parameter 1: the variable that holds the current item
+// Eg: voucher
+// Parameter 2: the collection, this can be a list, a JSON array such as a response
+// stored in res or a string delimited by "___"
+// Eg: vouchers
+// Parameter 3: the code that runs for every item
+// Eg: [PrintF("%v: %v", i, voucher)]
+// [Break()] and [Continue()] can be used inside the code to stop the loop or move to the next item
+// Given [Set(vouchers, "117-22427-719752___117-22427-719753", string)] the second example will output:
+// > 0: 117-22427-719752
+// > 1: 117-22427-719753
+func (d DataAPIService) ForEach(parameters []Node) interface{} {
+
+	// Gets the optional parameter 0 and parameters 1, 2 and 3
+	if len(parameters) != 3 && len(parameters) != 4 {
+		return errors.Errorf("ForEach expected 3 or 4 parameters but got: %v", len(parameters))
+	}
+	index := ""
+	if len(parameters) == 4 {
+		index = strings.TrimSpace(parameters[0].String())
+		parameters = parameters[1:]
+	}
+	item := strings.TrimSpace(parameters[0].String())
+	collection, err := d.EvalNode(parameters[1])
+	if err != nil {
+		return err
+	}
+	items, err := toList(collection)
+	if err != nil {
+		return err
+	}
+
+	// Run the code for every item in the collection
+	// Every iteration runs in a new block scope
+	err = d.each(index, item, items, parameters[2])
+	if err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+
+}
+
+// ForEachRow will run the code in the last parameter once for every row of a CSV or JSON data file
+// Usage: [ForEachRow(0, 1)] or [ForEachRow(0, 1, 2)]
+// Eg: [ForEachRow("data/vouchers.csv", [Pay(voucherNo, amount)][AssertSuccess()])]
+// Eg: [ForEachRow("data/vouchers.json", "voucherNo", [Pay(voucherNo, amount)][AssertSuccess()])]
+// Parameter 0: the data file relative to configs/dataapi, either a CSV file with a header line or
+// a JSON file holding an array of objects, or a list of JSON objects such as a response stored in res
+// Eg: "data/vouchers.csv"
+// Parameter 1: optional, the column whose value names the row in the report, rows are numbered by default
+// Eg: "voucherNo"
+// Parameter 2: the code that runs for every row, the columns of the row are set as variables
+// and the whole row is set as row, so any column can be read with row["Store ID"]
+// Eg: [Pay(voucherNo, amount)][AssertSuccess()]
+// Every cell of a CSV file is a string while JSON values keep their type
+// Every row gets its own node in the report and a row that fails does not stop the rows after it
+// Given data/vouchers.csv:
+// > voucherNo,amount
+// > 117-22427-719752,2000
+// > 117-22427-719753,500
+// The second example reports on voucherNo=117-22427-719752 and voucherNo=117-22427-719753
+func (d DataAPIService) ForEachRow(parameters []Node) interface{} {
+
+	// Gets parameter 0, the optional parameter 1 and parameter 2
+	if len(parameters) != 2 && len(parameters) != 3 {
+		return errors.Errorf("ForEachRow expected 2 or 3 parameters but got: %v", len(parameters))
+	}
+	data, err := d.EvalNode(parameters[0])
+	if err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	if file, ok := data.(string); ok {
+		rows, err = readRows("configs/dataapi/" + file)
+	} else {
+		rows, err = toRows(data)
+	}
+	if err != nil {
+		return err
+	}
+	name := ""
+	if len(parameters) == 3 {
+		name, err = d.EvalString(parameters[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Run the code for every row
+	// Every row runs in a new block scope
+	names, err := d.eachRow(rows, name, parameters[len(parameters)-1])
+	if err != nil {
+		return err
+	}
+
+	// Return the rows that ran for the report
+	return names
+
+}
+
+// Func will define a data function that is called just like any other data function
+// Usage: [Func(0, 1, 2, 3)]
+// Eg: [Func(pay, (voucher, amount), [Set(body, "{\"VoucherNo\": \"" + voucher + "\",\"Amount\":\"" + amount + "\"}", string)][Post(url, body, headers)][AssertSuccess()])]
+// Parameter 0: the name of the function
+// Eg: pay
+// Parameter 1: the names of the parameters in parenthesis
+// Eg: (voucher, amount)
+// Parameter 2: the code that runs when the function is called
+// Eg: [Post(url, body, headers)][AssertSuccess()]
+// Parameter 3: optional, the value the function returns once the body has run
+// Eg: res
+// The parameters are only available inside the body of the function
+// The above function is called with:
+// > [pay("117-22427-719752", "2000")]
+func (d DataAPIService) Func(parameters []Node) interface{} {
+
+	// Gets parameters 0, 1, 2 and the optional 3
+	if len(parameters) != 3 && len(parameters) != 4 {
+		return errors.Errorf("Func expected 3 or 4 parameters but got: %v", len(parameters))
+	}
+	name, ok := parameters[0].(*Ident)
+	if !ok {
+		return errors.Errorf("Func expected a function name but got: %v", parameters[0])
+	}
+	if d.isDataFunction(name.Name) {
+		return errors.Errorf("Func can not redefine the data function %v", name.Name)
+	}
+	var params []string
+	switch list := parameters[1].(type) {
+	case *Ident:
+		params = append(params, list.Name)
+	case *Tuple:
+		for _, item := range list.Items {
+			param, ok := item.(*Ident)
+			if !ok {
+				return errors.Errorf("Func expected a parameter name but got: %v", item)
+			}
+			for _, declared := range params {
+				if declared == param.Name {
+					return errors.Errorf("parameter %v of %v is declared more than once", param.Name, name.Name)
+				}
+			}
+			params = append(params, param.Name)
+		}
+	default:
+		return errors.Errorf("Func expected a parameter list but got: %v", parameters[1])
+	}
+
+	// Save the function on the EvalCache so that it can be called by name
+	function := &Function{
+		Name:   name.Name,
+		Params: params,
+		Body:   parameters[2],
+		Scope:  d.scope(),
+	}
+	if len(parameters) == 4 {
+		function.Result = parameters[3]
+	}
+	d.scope().Set(name.Name, function)
+
+	// Return success
+	return nil
 
 }
 
@@ -736,37 +1220,152 @@ func (d DataAPIService) GetResults(report tools.Tree) ([]string, []string, error
 
 }
 
+// Global will make Set write the given variables to the global scope instead of the current file
+// The declaration lasts until the end of the current file or function
+// Usage: [Global(0, 1...)]
+// Eg: [Global(count)]
+// Parameter 0++: the names of the variables that are global
+// Eg: count
+// [Set(count, count+1, int)] will now update the count that every file can see
+func (d DataAPIService) Global(parameters []Node) interface{} {
+
+	// Gets parameters 0, 1...
+	if len(parameters) == 0 {
+		return errors.Errorf("Global expected atleast 1 parameter but got: %v", len(parameters))
+	}
+
+	// Declare every variable as global
+	for _, parameter := range parameters {
+		d.scope().Global(strings.TrimSpace(parameter.String()))
+	}
+
+	// Return success
+	return nil
+
+}
+
+// HMAC will return the HMAC of a message signed with a key
+// Usage: [HMAC(0, 1, 2)] or [HMAC(0, 1, 2, 3)]
+// Eg: [Set(headers, ["X-Signature: {{[HMAC(\"SHA256\", key, body)]}}"], list)]
+// Parameter 0: the hash algorithm, SHA1, SHA256, SHA384 or SHA512
+// Eg: "SHA256"
+// Parameter 1: the secret key
+// Eg: key
+// Parameter 2: the message to sign
+// Eg: body
+// Parameter 3: optional, the encoding of the HMAC, hex, base64, base64url or raw, hex is used by default
+// Eg: "base64"
+func (d DataAPIService) HMAC(alg string, key string, msg string, encoding string) (string, error) {
+
+	_, newH, err := newHash(alg)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(newH, []byte(key))
+	mac.Write([]byte(msg))
+
+	return encode(mac.Sum(nil), encoding)
+
+}
+
+// Help will return how a data function is called and what it does
+// Usage: [Help(0)]
+// Eg: [PrintF("%v", [Help("PrintF")])]
+// Parameter 0: the name of the data function
+// Eg: "PrintF"
+// The above will output:
+// > PrintF(format code, [values code...])
+// > PrintF logs the formatted values
+func (d DataAPIService) Help(name string) (string, error) {
+
+	// Find the registered data function
+	function, ok := d.registry().Lookup(name)
+	if !ok {
+		return "", errors.Errorf("data function %v not found", name)
+	}
+
+	// Return the usage and the help text
+	return function.Usage() + "\n" + function.Signature.Help, nil
+
+}
+
+// HexEncode will return the string encoded in hex
+// Usage: [HexEncode(0)]
+// Eg: [PrintF("%v", [HexEncode("hello")])]
+// Parameter 0: the string to encode
+// Eg: "hello"
+// The above will output:
+// > 68656c6c6f
+func (d DataAPIService) HexEncode(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
+
 // If is just like your normal if statement:
-// Usage: If(0, 1)
+// Usage: If(0, 1) or If(0, 1, 2)
 // Eg: [If((i < 3), [Println("Hello World")])]
+// Eg: [If(res == "success", [PrintF("Passed")], [PrintF("Failed")])]
 // Parameter 0: the condition that will allow the statement to execute
 // Eg: (i < 3)
 // Parameter 1: is the code that runs inside the if statement
 // Eg: [PrintF("Hello World %v", i)][Set(i,i+1,int)]
+// Parameter 2: optional, is the code that runs when the condition is false
+// Eg: [PrintF("Goodbye World %v", i)]
 // Hello World will print if the parameter 0 evaluates to true
-func (d DataAPIService) If(params string) interface{} {
+// Failures inside a branch are reported under the branch that ran, "then" or "else"
+func (d DataAPIService) If(parameters []Node) interface{} {
 
-	// Gets parameters 0 and 1
-	parameters := d.GetParameters(params)
-	if len(parameters) != 2 {
-		return errors.Errorf("if statement expected 2 parameters but got: %v", len(parameters))
+	// Gets parameters 0 and 1 and the optional parameter 2
+	if len(parameters) != 2 && len(parameters) != 3 {
+		return errors.Errorf("if statement expected 2 or 3 parameters but got: %v", len(parameters))
 	}
 	boolean, err := d.EvalBool(parameters[0])
 	if err != nil {
 		return err
 	}
 
-	// If true then run the expression in parameter 1
+	// If true then run the expression in parameter 1, otherwise the expression in parameter 2
 	if boolean {
-		res, err := d.Eval(parameters[1])
+		return d.branch("then", parameters[1])
+	}
+	if len(parameters) == 3 {
+		return d.branch("else", parameters[2])
+	}
+
+	// Return success
+	return nil
+
+}
+
+// IfElse is an if statement with any number of else if branches
+// Usage: [IfElse(0, 1, 2, 3...)]
+// Eg: [IfElse(code == -22, [PrintF("Not found")], code < 0, [PrintF("Failed")], [PrintF("Passed")])]
+// Parameters are pairs of a condition and the code that runs if the condition is true
+// Only the code of the first condition that is true runs
+// Eg: code == -22, [PrintF("Not found")]
+// Last parameter: optional, the code that runs when none of the conditions are true
+// Eg: [PrintF("Passed")]
+// Failures inside a branch are reported under the condition of the branch that ran, or "else"
+func (d DataAPIService) IfElse(parameters []Node) interface{} {
+
+	// Requires at least one condition and its code
+	if len(parameters) < 2 {
+		return errors.Errorf("IfElse expected at least 2 parameters but got: %v", len(parameters))
+	}
+
+	// Run the code of the first condition that evaluates to true
+	for i := 0; i+1 < len(parameters); i += 2 {
+		boolean, err := d.EvalBool(parameters[i])
 		if err != nil {
 			return err
 		}
-		errVal, ok := res["error"]
-		if ok {
-			return errVal.(error)
+		if boolean {
+			return d.branch("if "+parameters[i].String(), parameters[i+1])
 		}
+	}
 
+	// Run the else branch if there is one
+	if len(parameters)%2 == 1 {
+		return d.branch("else", parameters[len(parameters)-1])
 	}
 
 	// Return success
@@ -774,130 +1373,398 @@ func (d DataAPIService) If(params string) interface{} {
 
 }
 
+// Import will load the variables and functions defined in a library file into the current scope
+// The library is run once per Data API run and is not added to the report as a test case
+// Importing the same library again reuses the definitions from the first import
+// Usage: [Import(0)]
+// Eg: [Import("lib/payments.txt")]
+// Parameter 0: the library file you want to import
+// Eg: "lib/payments.txt"
+func (d DataAPIService) Import(inFile string) error {
+
+	d = d.withRun()
+	filepath := "configs/dataapi/" + inFile
+	library, ok := d.Run.imports[filepath]
+	if !ok {
+		// Libraries that import each other can never finish loading
+		for _, importing := range d.Run.importing {
+			if importing == filepath {
+				cycle := append(d.Run.importing, filepath)
+				return errors.Errorf("import cycle: %v", strings.Join(cycle, " -> "))
+			}
+		}
+
+		// Read and parse the library
+		dataRaw, err := ioutil.ReadFile(filepath)
+		if err != nil {
+			return err
+		}
+		script := ParseScript(filepath, string(dataRaw))
+
+		// Run the library in its own scope layered over the global scope
+		// so that the definitions do not depend on where it was first imported
+		d.Run.importing = append(d.Run.importing, filepath)
+		library = NewScope(&Scope{Vars: d.EvalCache})
+		local := d
+		local.Scope = library
+		var allErrors EvalErrors
+		for _, statement := range script.Statements {
+			_, err := local.EvalNode(statement)
+			if signal, ok := err.(*Signal); ok && signal.Kind == SignalReturn {
+				break
+			}
+			if err != nil {
+				allErrors = append(allErrors, err)
+			}
+		}
+		d.Run.importing = d.Run.importing[:len(d.Run.importing)-1]
+		if err := allErrors.Err(); err != nil {
+			return err
+		}
+		d.Run.imports[filepath] = library
+	}
+
+	// Copy the definitions of the library into the current scope
+	for name, value := range library.Vars {
+		d.scope().Set(name, value)
+	}
+
+	// Return success
+	return nil
+
+}
+
+// JWTDecode will return the claims of a JSON Web Token
+// Usage: [JWTDecode(0)]
+// Eg: [Set(claims, [JWTDecode(body.Token)], map)][AssertEquals(claims.sub, "wallet1")]
+// Parameter 0: the token
+// Eg: body.Token
+// The signature of the token is not verified
+func (d DataAPIService) JWTDecode(token string) (map[string]interface{}, error) {
+	return decodeJWT(token)
+}
+
+// JWTSign will return a JSON Web Token holding the claims
+// Usage: [JWTSign(0, 1, 2)]
+// Eg: [Set(token, [JWTSign(claims, key, "HS256")], string)] after [Set(claims, "{\"sub\": \"wallet1\"}", map)]
+// Parameter 0: the claims, a map or a string holding a JSON object
+// Eg: claims
+// Parameter 1: the secret key for HS algorithms, or a PEM encoded RSA private key for RS algorithms
+// Eg: key
+// Parameter 2: the algorithm, HS256, HS384, HS512, RS256, RS384 or RS512
+// Eg: "HS256"
+func (d DataAPIService) JWTSign(claims interface{}, key string, alg string) (string, error) {
+
+	object, err := toObject(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return signJWT(object, key, alg)
+
+}
+
+// Join will return the items of a list joined into a string
+// Usage: [Join(0, 1)]
+// Eg: [Set(ids, [Join(vouchers, ",")], string)]
+// Parameter 0: the list to join, this can also be a JSON array
+// Eg: vouchers
+// Parameter 1: the separator placed between the items
+// Eg: ","
+func (d DataAPIService) Join(items []interface{}, sep string) (string, error) {
+
+	strs, err := toStrings(items)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(strs, sep), nil
+
+}
+
+// Len will return the number of items in a list or the number of characters in a string
+// Usage: [Len(0)]
+// Eg: [For(i < [Len(vouchers)], [PrintF("%v", vouchers[i])][Set(i, i+1, int)])]
+// Parameter 0: the list or string
+// Eg: vouchers
+func (d DataAPIService) Len(parameters []Node) interface{} {
+
+	// Gets parameter 0
+	if len(parameters) != 1 {
+		return errors.Errorf("Len expected 1 parameter but got: %v", len(parameters))
+	}
+	val, err := d.EvalNode(parameters[0])
+	if err != nil {
+		return err
+	}
+
+	// Return the length
+	n, err := length(val)
+	if err != nil {
+		return err
+	}
+
+	return n
+
+}
+
+// Lower will return the string in lower case
+// Usage: [Lower(0)]
+// Eg: [AssertEquals([Lower(body.Status)], "success")]
+// Parameter 0: the string
+// Eg: body.Status
+func (d DataAPIService) Lower(s string) string {
+	return strings.ToLower(s)
+}
+
+// Match will return true if a string matches a regular expression
+// Usage: [Match(0, 1)]
+// Eg: [If([Match(voucher, "^117-")], [PrintF("Store voucher")])]
+// Parameter 0: the string to check
+// Eg: voucher
+// Parameter 1: the regular expression, use ^ and $ to match the whole string
+// Eg: "^117-"
+func (d DataAPIService) Match(s string, re string) (bool, error) {
+
+	r, err := compileRegexp(re)
+	if err != nil {
+		return false, err
+	}
+
+	return r.MatchString(s), nil
+
+}
+
+// Now will return the current time, or the frozen clock of the run when it is set
+// Usage: [Now()] or [Now(0)]
+// Eg: [Set(start, [Now()], time)] or [Set(requestDT, [Now("DateTime")], string)]
+// Parameter 0: optional, the layout to format the time with, see FormatTime
+// Eg: "DateTime"
+// Without a layout the time is returned as a time, which prints in RFC3339Nano
+func (d DataAPIService) Now(layout string) interface{} {
+
+	if layout == "" {
+		return d.now()
+	}
+
+	return formatTime(d.now(), layout)
+
+}
+
 // ParallelPost is a data function that will send multiple POST requests in parallel
 // Usage:
-// [Set(files, "file1.txt___file2.txt", string)]
-// [Set(headers, "Monkey:::Madness---Content-Type:::application/json___Monkey:::Madness---Content-Type:::application/json"
-// [Set(jsons, "{\"Data\": \"1234\"}___{\"Data\": \"5678\"}", string)]
-// [Set(urls, "https://someUrl.com/someEndpoint___https://someOtherUrl.com/someOtherEndpoint", string)]
-// [ParallelPost(files, jsons, urls)]
+// [Set(files, ["file1.txt", "file2.txt"], list)]
+// [Set(headers, [["Monkey: Madness", "Content-Type: application/json"], ["Monkey: Madness"]], list)]
+// [Set(jsons, ["{\"Data\": \"1234\"}", "{\"Data\": \"5678\"}"], list)]
+// [Set(urls, ["https://someUrl.com/someEndpoint", "https://someOtherUrl.com/someOtherEndpoint"], list)]
+// [ParallelPost(files, headers, jsons, urls)]
 //
-// Parameter 0: array list delimited by "___" of the multipart files you want to attach to the multipart request:
-// Eg: "file1.txt___file2.txt"
-// Parameter 1: array list delimited by "___" of multiple key value pairs (mapped with ":::" and seperated by "---") that is the HTTP request headers:
-// Eg: "Monkey:::Madness---Content-Type:::application/json___Monkey:::Madness---Content-Type:::application/json" will add the following headers:
+// Parameter 0: list of the multipart files you want to attach to the multipart request:
+// Eg: ["file1.txt", "file2.txt"]
+// Parameter 1: list of the HTTP request headers of every request, each a list of "Key: Value" strings:
+// Eg: [["Monkey: Madness", "Content-Type: application/json"], ["Monkey: Madness"]] will add the following headers:
 // Request1 headers: Monkey: Madness, Content-Type: application/json
-// Request2 headers: Monkey: Madness, Content-Type: application/json
-// Parameter 2: array list delimited by "___" of the json bodies
-// Eg: "{\"Data\": \"1234\"}___{\"Data\": \"5678\"}"
-// Parameter 3: array list delimited by "___" of the urls to send the request to
+// Request2 headers: Monkey: Madness
+// Parameter 2: list of the json bodies, JSON strings or json values created with Set
+// Eg: ["{\"Data\": \"1234\"}", "{\"Data\": \"5678\"}"]
+// Parameter 3: list of the urls to send the request to
+//
+// The legacy format of strings delimited by "___" is still supported for every parameter,
+// with the headers of a request mapped with ":::" and separated by "---"
+// Eg: "Monkey:::Madness---Content-Type:::application/json___Monkey:::Madness"
 //
 // ParallelPost will save the respective responses of the POST requests on the EvalCache as "ParallelPostX"
 // Where X is an integer value
 // You can access the raw JSON string response from:
 // [Set(response1, [Res("ParallelPost1")], string)]
 // [Set(response2, [Res("ParallelPost2")], string)]
-func (d DataAPIService) ParallelPost(params string) interface{} {
+func (d DataAPIService) ParallelPost(parameters []Node) interface{} {
 
 	// Gets parameters 0, 1, 2 and 3
-	parameters := d.GetParameters(params)
 	if len(parameters) != 4 {
 		return errors.Errorf("data function 'ParallelPost' expected 4 parameters but got: %v", len(parameters))
 	}
-	filesRaw, err := d.EvalString(parameters[0])
+	filesRaw, err := d.EvalNode(parameters[0])
 	if err != nil {
 		return err
 	}
-	_ = strings.Split(filesRaw, "___")
+	if _, err := toList(filesRaw); err != nil {
+		return err
+	}
 	var headers []map[string]string
-	allHeadersRaw, err := d.EvalString(parameters[1])
+	allHeadersRaw, err := d.EvalNode(parameters[1])
 	if err != nil {
 		return err
 	}
-	allHeadersArr := strings.Split(allHeadersRaw, "___")
-	for _, headersArr := range allHeadersArr {
-		headersMap := make(map[string]string)
-		headersArr := strings.Split(headersArr, "---")
-		for _, header := range headersArr {
-			header := strings.Split(header, ":::")
-			if len(header) != 2 {
-				return errors.Errorf("header is not in the format 'key::value'")
-			}
-			headersMap[header[0]] = header[1]
+	allHeaders, err := toList(allHeadersRaw)
+	if err != nil {
+		return err
+	}
+	for _, headersRaw := range allHeaders {
+		headersMap, err := toHeaders(headersRaw, "---", ":::")
+		if err != nil {
+			return err
 		}
 		headers = append(headers, headersMap)
 	}
 	var jsonMaps []map[string]interface{}
-	jsonsRaw, err := d.EvalString(parameters[2])
+	jsonsRaw, err := d.EvalNode(parameters[2])
+	if err != nil {
+		return err
+	}
+	jsons, err := toList(jsonsRaw)
 	if err != nil {
 		return err
 	}
-	jsons := strings.Split(jsonsRaw, "___")
 	for _, jsonBody := range jsons {
-		jsonBody = strings.Replace(jsonBody, "\\\"", "\"", -1)
-		jsonMap := make(map[string]interface{})
-		err = json.Unmarshal([]byte(jsonBody), &jsonMap)
+		jsonMap, err := toObject(jsonBody)
 		if err != nil {
 			return err
 		}
 		jsonMaps = append(jsonMaps, jsonMap)
 	}
-	urlsRaw, err := d.EvalString(parameters[3])
+	urlsRaw, err := d.EvalNode(parameters[3])
+	if err != nil {
+		return err
+	}
+	urls, err := toStrings(urlsRaw)
 	if err != nil {
 		return err
 	}
-	urls := strings.Split(urlsRaw, "___")
 	if len(urls) != len(jsonMaps) {
 		return errors.New(fmt.Sprintf("number of URLs (%v) does not align with the number of JSON bodies (%v)", len(urls), len(jsons)))
 	}
+	if len(headers) != len(jsonMaps) {
+		return errors.New(fmt.Sprintf("number of headers (%v) does not align with the number of JSON bodies (%v)", len(headers), len(jsons)))
+	}
 
 	// Make the Post requests asynchronously
+	// Each request writes its response into its own index so no locking is needed
 	var waitGroup sync.WaitGroup
+	responses := make([]interface{}, len(jsonMaps))
 	for i := 0; i < len(jsonMaps); i++ {
 		waitGroup.Add(1)
 		go func(url string, header map[string]string, jsonBody map[string]interface{}, i int) {
 			defer waitGroup.Done()
-			resp, err := web.DoRequest(url, header, http.MethodPost, jsonBody)
+			resp, err := web.DoRequest(d.context(), url, header, http.MethodPost, jsonBody)
 			if err != nil {
-				d.EvalCache[fmt.Sprintf("ParallelPost%v", i)] = errors.Errorf("error sending POST request to URL %v", url)
+				responses[i] = errors.Errorf("error sending POST request to URL %v", url)
 				return
 			}
-			d.EvalCache[fmt.Sprintf("ParallelPost%v", i)] = string(resp)
+			responses[i] = string(resp)
 		}(urls[i], headers[i], jsonMaps[i], i)
 	}
 
 	// Wait until all the POST requests are complete
+	// Then save the responses on the EvalCache
 	waitGroup.Wait()
+	if err := d.done(); err != nil {
+		return err
+	}
+	for i, response := range responses {
+		d.scope().Set(fmt.Sprintf("ParallelPost%v", i), response)
+	}
 
 	// Return success
 	return nil
 
 }
 
+// Params will declare the named parameters a file is Evaluated with
+// Usage: [Params(0, 1, ...)]
+// Eg: [Params(storeID, amount=100)]
+// Parameter 0++: the names of the required parameters followed by the optional parameters with their default value
+// Eg: storeID, amount=100
+// Given: [Evaluate("payments/pay.txt", storeID="Store1")]
+// This will set storeID to "Store1" and amount to 100 in payments/pay.txt
+// The file stops running if a required parameter is missing or it is Evaluated with a parameter it does not declare
+func (d DataAPIService) Params(parameters []Node) interface{} {
+
+	// Every named parameter of the file must be declared
+	// Optional parameters that were not given are set to their default value
+	scope := d.scope().boundary()
+	declared := make(map[string]bool)
+	var missing []string
+	for _, parameter := range parameters {
+		switch parameter := parameter.(type) {
+		case *Ident:
+			declared[parameter.Name] = true
+			if !scope.args[parameter.Name] {
+				missing = append(missing, parameter.Name)
+			}
+		case *NamedArg:
+			declared[parameter.Name] = true
+			if scope.args[parameter.Name] {
+				continue
+			}
+			val, err := d.EvalNode(parameter.Value)
+			if err != nil {
+				return err
+			}
+			scope.Define(parameter.Name, val)
+		default:
+			return errors.Errorf("Params expected a parameter name but got: %v", parameter)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("missing required parameters: %v", strings.Join(missing, ", "))
+	}
+	var unknown []string
+	for name := range scope.args {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown parameters: %v", strings.Join(unknown, ", "))
+	}
+
+	// Return success
+	return nil
+
+}
+
+// ParseTime will return the time held in a string
+// Usage: [ParseTime(0)] or [ParseTime(0, 1)]
+// Eg: [Set(created, [ParseTime(body.CreatedDT, "DateTime")], time)]
+// Parameter 0: the string holding the time
+// Eg: "2021-06-01 10:00:00"
+// Parameter 1: optional, the layout of the string, see FormatTime, RFC3339 is used by default
+// Eg: "DateTime"
+func (d DataAPIService) ParseTime(s string, layout string) (Time, error) {
+	return parseTime(s, layout)
+}
+
 // Pass is a function that can not fail and is used to build the failures/passes tree
 // to return a Data API output report
-func (d DataAPIService) Pass(params string) {
+func (d DataAPIService) Pass(parameters []Node) {
 	return
 }
 
 // Post will send a POST request which includes a file and JSON data
 // Usage: [Post(0, 1, 2)]
-// Eg: 	[Set(url, "https://rnd-api-v1-dot-dev8celbux.uc.r.appspot.com/api/rnd/pay?ns=rnd", string)]
+// Eg: 	[Set(currency, "ZAR", string)]
+//     	[Set(url, "https://rnd-api-v1-dot-dev8celbux.uc.r.appspot.com/api/rnd/pay?ns=rnd", string)]
 //     	[Set(jsonBody, "{\"VoucherNo\": \"117-22427-719752\",\"StoreID\":\"Store1\",\"Reference\":\"1234\",\"Amount\":\"2000\",\"Currency\":\"{{currency}}\",\"Metadata\":\"\",\"RequestDT\":\"1234\"}", string)]
-//		[Set(heders, "Authorization___Bearer 9m1,Monkey___Madness", string)]
+//		[Set(headers, ["Authorization: Bearer {{[Secret(\"TOKEN\")]}}", "Monkey: Madness"], list)]
 //		[Post(url, jsonBody, headers)]
 // Parameter 0: the target url
 // Eg: "https://rnd-api-v1-dot-dev8celbux.uc.r.appspot.com/api/rnd/pay?ns=rnd"
-// Parameter 1: json input
+// Parameter 1: json input, a JSON string or a json value created with Set
 // Eg: "{\"VoucherNo\": \"117-22427-719752\",\"StoreID\":\"Store1\",\"Reference\":\"1234\",\"Amount\":\"2000\",\"Currency\":\"{{currency}}\",\"Metadata\":\"\",\"RequestDT\":\"1234\"}"
-// Parameter 2: request headers
+// Parameter 2: request headers, a list of "Key: Value" strings or a map
+// Eg: ["Authorization: Bearer {{[Secret(\"TOKEN\")]}}", "Monkey: Madness"]
+// Keep tokens out of data code files with Secret, which also redacts them from the logs and report
+// The legacy format of a string of "key___value" pairs separated by "," is still supported
 // Eg: "Authorization___Bearer 9m1,Monkey___Madness"
+// Placeholders such as {{currency}} in any string literal are filled in from the current scope
 // The JSON response will be set under the variable "res" on the EvalCache and be accessed by the Res data function
+// res is a Response, so fields of the JSON response are read with res.Field and the body with res.Body
 // Eg: [Set(response1, [Res("res")], string)]
-func (d DataAPIService) Post(params string) interface{} {
+func (d DataAPIService) Post(parameters []Node) interface{} {
 
 	// Gets parameters 0, 1 and 2
-	parameters := d.GetParameters(params)
 	if len(parameters) != 3 {
 		return errors.Errorf("data function 'Post' expected 3 parameters but got: %v", len(parameters))
 	}
@@ -905,43 +1772,38 @@ func (d DataAPIService) Post(params string) interface{} {
 	if err != nil {
 		return err
 	}
-	jsonStr, err := d.EvalString(parameters[1])
+	jsonRaw, err := d.EvalNode(parameters[1])
 	if err != nil {
 		return err
 	}
-	jsonStr = strings.Replace(jsonStr, "\\\"", "\"", -1)
-	jsonMap := make(map[string]interface{})
-	err = json.Unmarshal([]byte(jsonStr), &jsonMap)
+	jsonMap, err := toObject(jsonRaw)
 	if err != nil {
 		return err
 	}
-	headers := make(map[string]string)
-	headersRaw, err := d.EvalString(parameters[2])
+	headersRaw, err := d.EvalNode(parameters[2])
 	if err != nil {
 		return err
 	}
-	headersArr := strings.Split(headersRaw, ",")
-	for _, headerRaw := range headersArr {
-		if headerRaw == "" {
-			continue
-		}
-		header := strings.Split(headerRaw, "___")
-		if len(header) != 2 {
-			return errors.Errorf("header is not in the format 'key___value'")
-		}
-		headers[header[0]] = header[1]
+	headers, err := toHeaders(headersRaw, ",", "___")
+	if err != nil {
+		return err
 	}
 
 	// Make the Post request
-	resp, err := web.DoRequest(url, headers, http.MethodPost, jsonMap)
+	// The request is cancelled when the evaluation is cancelled or times out
+	resp, err := web.DoRequest(d.context(), url, headers, http.MethodPost, jsonMap)
 	response := string(resp)
+	if done := d.done(); done != nil {
+		return done
+	}
 	if err != nil {
 		return err
 	}
-	d.EvalCache["res"] = response
-	if string(resp) == "" {
-		d.EvalCache["res"] = []string{"success"}
+	res, err := NewResponse(response)
+	if err != nil {
+		return err
 	}
+	d.scope().Set("res", res)
 
 	// Return success
 	return nil
@@ -957,33 +1819,31 @@ func (d DataAPIService) Post(params string) interface{} {
 // Eg: 1, 2, 3
 // This will output:
 // > Hello World 123
-func (d DataAPIService) PrintF(params string) interface{} {
+func (d DataAPIService) PrintF(parameters []Node) interface{} {
 
 	// Gets parameters 0, 1 and 2...
-	parameters := d.GetParameters(params)
 	if len(parameters) == 0 {
 		return errors.Errorf("PrintF expected atleast 1 parameter but got: %v", len(parameters))
 	}
 
 	// Get format as first param
-	format := parameters[0]
+	format, err := d.EvalString(parameters[0])
+	if err != nil {
+		return err
+	}
 
 	// Build []interface{} so that we can call input our data into the variadic field in fmt.Sprintf
 	var aInterfaces []interface{}
-	for i, s := range parameters {
-		if i == 0 {
-			continue
-		}
-		sOut, err := d.Eval(s)
+	for _, parameter := range parameters[1:] {
+		val, err := d.EvalNode(parameter)
 		if err != nil {
 			return err
 		}
-		aInterfaces = append(aInterfaces, sOut["val"])
+		aInterfaces = append(aInterfaces, val)
 	}
 
-	// Print with trimming the wrapping parenthesis
+	// Print the formatted string
 	s := fmt.Sprintf(format, aInterfaces...)
-	s = s[1:len(s)-1]
 	d.Log.Println(s)
 
 	// Return success
@@ -991,6 +1851,74 @@ func (d DataAPIService) PrintF(params string) interface{} {
 
 }
 
+// RandomChoice will return a random item of a list
+// Usage: [RandomChoice(0)]
+// Eg: [Set(store, [RandomChoice(["Store1", "Store2", "Store3"])], string)]
+// Parameter 0: the list to choose from, this can also be a JSON array or a string delimited by "___"
+// Eg: ["Store1", "Store2", "Store3"]
+// The choice is repeatable with the seed of the run
+func (d DataAPIService) RandomChoice(items []interface{}) (interface{}, error) {
+
+	if len(items) == 0 {
+		return nil, errors.New("RandomChoice can not choose from an empty list")
+	}
+
+	return items[d.withRun().Run.intn(len(items))], nil
+
+}
+
+// RandomInt will return a random int between min and max, both included
+// Usage: [RandomInt(0, 1)]
+// Eg: [Set(amount, [RandomInt(100, 2000)], int)]
+// Parameter 0: the smallest int that can be returned
+// Eg: 100
+// Parameter 1: the largest int that can be returned
+// Eg: 2000
+// The int is repeatable with the seed of the run
+func (d DataAPIService) RandomInt(min int, max int) (int, error) {
+
+	if max < min {
+		return 0, errors.Errorf("RandomInt expected min %v to be at most max %v", min, max)
+	}
+
+	// The number of ints in the range overflows when the range is wider than the largest int
+	span := max - min + 1
+	if span <= 0 {
+		return 0, errors.Errorf("RandomInt range from %v to %v is too large", min, max)
+	}
+
+	return min + d.withRun().Run.intn(span), nil
+
+}
+
+// RandomString will return a random string of n characters
+// Usage: [RandomString(0)] or [RandomString(0, 1)]
+// Eg: [Set(reference, [RandomString(12)], string)]
+// Eg: [Set(pin, [RandomString(4, "0123456789")], string)]
+// Parameter 0: the number of characters
+// Eg: 12
+// Parameter 1: optional, the characters to choose from, letters and digits are used by default
+// Eg: "0123456789"
+// The string is repeatable with the seed of the run
+func (d DataAPIService) RandomString(n int, charset string) (string, error) {
+
+	chars := []rune(charset)
+	if len(chars) == 0 {
+		return "", errors.New("RandomString can not choose from an empty charset")
+	}
+	if n < 0 {
+		return "", errors.Errorf("RandomString expected a length of at least 0 but got: %v", n)
+	}
+	run := d.withRun().Run
+	out := make([]rune, n)
+	for i := range out {
+		out[i] = chars[run.intn(len(chars))]
+	}
+
+	return string(out), nil
+
+}
+
 // ReadFile will read the string data from the given filepath and
 // save its contents under the given variable on the EvalCache
 // Usage: [ReadFile(0, 1)]
@@ -999,11 +1927,10 @@ func (d DataAPIService) PrintF(params string) interface{} {
 // Eg: "expected"
 // Parameter 1: the filepath of the file we want to read, the value is relative the root directory
 // Eg: "configs/dataapi/cascadingerrors/expected_output.txt"
-func (d DataAPIService) ReadFile(params string) interface{} {
+func (d DataAPIService) ReadFile(parameters []Node) interface{} {
 
 	// Gets parameters 0 and 1
-	parameters := d.GetParameters(params)
-	if len(parameters) == 0 {
+	if len(parameters) != 2 {
 		return errors.Errorf("ReadFile expected 2 parameters but got: %v", len(parameters))
 	}
 	variable, err := d.EvalString(parameters[0])
@@ -1027,11 +1954,24 @@ func (d DataAPIService) ReadFile(params string) interface{} {
 	data := string(dataRaw)
 
 	// Save the contents of the file under the given variable on the EvalCache
-	d.EvalCache[variable] = data
+	d.scope().Set(variable, data)
 
 	return data
 }
 
+// Replace will return the string with every occurrence of old replaced by new
+// Usage: [Replace(0, 1, 2)]
+// Eg: [Set(voucher, [Replace(voucher, "-", "")], string)]
+// Parameter 0: the string
+// Eg: voucher
+// Parameter 1: the substring to replace
+// Eg: "-"
+// Parameter 2: the replacement
+// Eg: ""
+func (d DataAPIService) Replace(s string, old string, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
 // Res will return the given property out of the EvalCache
 // Usage: Res(0)
 // Eg: [Res("error")]
@@ -1039,10 +1979,9 @@ func (d DataAPIService) ReadFile(params string) interface{} {
 // Eg: "error"
 // This will try return the "error" field from EvalCache["res"]:
 // > Invalid request
-func (d DataAPIService) Res(params string) interface{} {
+func (d DataAPIService) Res(parameters []Node) interface{} {
 
 	// Gets parameter 0
-	parameters := d.GetParameters(params)
 	if len(parameters) != 1 {
 		return errors.Errorf("Res expected 1 parameter but got: %v", len(parameters))
 	}
@@ -1052,7 +1991,7 @@ func (d DataAPIService) Res(params string) interface{} {
 	}
 
 	// Get the field
-	out, ok := d.EvalCache[field]
+	out, ok := d.scope().Get(field)
 	if !ok {
 		return errors.Errorf("field %v could not be found on the EvalCache", field)
 	}
@@ -1062,59 +2001,102 @@ func (d DataAPIService) Res(params string) interface{} {
 
 }
 
-// Sleep will sleep for X seconds
-// Usage: [Sleep(0)]
-// Eg: [Sleep(5)]
-// Parameter 0: the amount of seconds you want to sleep
-// Eg: 5
-func (d DataAPIService) Sleep(params string) interface{} {
+// Return will stop the user defined function or file it is called in
+// Usage: [Return(0)]
+// Eg: [Func(double, (a), [Return(a*2)])] or [If(skip, [Return()])]
+// Parameter 0: optional, the value the function returns
+// Eg: a*2
+// The rest of the function or file will not run
+func (d DataAPIService) Return(parameters []Node) interface{} {
+
+	// Gets the optional parameter 0
+	if len(parameters) > 1 {
+		return errors.Errorf("Return expected atmost 1 parameter but got: %v", len(parameters))
+	}
+	signal := &Signal{Kind: SignalReturn}
+	if len(parameters) == 1 {
+		val, err := d.EvalNode(parameters[0])
+		if err != nil {
+			return err
+		}
+		signal.Value = val
+	}
 
-	// Gets parameter 0
-	parameters := d.GetParameters(params)
-	if len(parameters) != 1 {
-		return errors.Errorf("Sleep expected 1 parameter but got: %v", len(parameters))
+	return signal
+
+}
+
+// SHA256 will return the SHA-256 hash of a string
+// Usage: [SHA256(0)] or [SHA256(0, 1)]
+// Eg: [Set(digest, [SHA256(body)], string)]
+// Parameter 0: the string to hash
+// Eg: body
+// Parameter 1: optional, the encoding of the hash, hex, base64, base64url or raw, hex is used by default
+// Eg: "base64"
+func (d DataAPIService) SHA256(s string, encoding string) (string, error) {
+	sum := sha256.Sum256([]byte(s))
+	return encode(sum[:], encoding)
+}
+
+// Secret will return the value of a secret
+// Usage: [Secret(0)]
+// Eg: [Set(headers, ["Authorization: Bearer {{[Secret(\"TOKEN\")]}}"], list)]
+// Parameter 0: the name of the secret
+// Eg: "TOKEN"
+// The secret is read from the secrets file of the Data API, or the environment variable with the same name
+// Its value is redacted as ***** from PrintF, the logs, the report and failures for the rest of the run
+func (d DataAPIService) Secret(name string) (string, error) {
+
+	// Get the secret from the secrets file or the environment
+	value, ok := d.Secrets[name]
+	if !ok {
+		value, ok = os.LookupEnv(name)
 	}
-	seconds, err := d.EvalInt(parameters[0])
-	if err != nil {
-		return err
+	if !ok {
+		return "", errors.Errorf("secret %v not found", name)
 	}
 
-	// Sleep ZZZzzz...
-	time.Sleep(time.Duration(seconds) * time.Second)
+	// Redact the secret for the rest of the run
+	d.withRun().Run.addSecret(value)
 
-	return nil
+	// Return the secret
+	return value, nil
 
 }
 
+// Sequence will return the next number of the named sequence, starting at 1
+// Usage: [Sequence(0)]
+// Eg: [Set(reference, "REF-{{[Sequence(\"reference\")]}}", string)]
+// Parameter 0: the name of the sequence, every sequence counts on its own
+// Eg: "reference"
+// Sequences count across all the files of a run
+func (d DataAPIService) Sequence(name string) int {
+	return d.withRun().Run.next(name)
+}
+
 // Set will create a variable on the EvalCache
+// The variable is created in the current file or function, unless it already exists there
+// or has been declared with Global
 // Usage: [Set(0, 1, 2)]
-// Eg: [Set(i, 0, int)] or [Set(s, "hello world!", string)]
+// Eg: [Set(i, 0, int)] or [Set(s, "hello world!", string)] or [Set(ids, [1, 2, 3], []int)]
 // Parameter 0: the name of the variable
 // Eg: i
 // Parameter 1: the value of the variable
 // Eg: 0
 // Parameter 2: the type of the value
-// Eg: int, string, bool
+// Eg: int, float, decimal, string, boolean, list, []string, []int, json, map, time, duration
+// A decimal is exact and keeps its decimal places, use it for money amounts
+// Eg: [Set(amount, "20.00", decimal)] or [Set(balance, balance - amount, decimal)]
+// A list can be set from a list, a JSON array or a string delimited by "___"
+// A json value is parsed from a JSON string, a map must be a JSON object
+// Eg: [Set(body, [Res("res")], json)] after which fields can be read with body.Failures[0] or body["Error"]
+// A time is set from a time or an RFC3339 string and a duration from a duration, a string such as "24h" or seconds
+// Eg: [Set(expiry, [Now()] + ttl, time)] after [Set(ttl, "24h", duration)]
 // Therefore, the above is the equivalent to running 'i := 0'
 // The variable 'i' will be available when Eval() is run as it is set on the EvalCache
-func (d DataAPIService) Set(params string) interface{} {
+func (d DataAPIService) Set(parameters []Node) interface{} {
 
 	// Gets parameters 0, 1, and 2
-	parameters := d.GetParameters(params)
-	rawString := ""
-	if len(parameters) > 3 {
-		for i, parameter := range parameters {
-			if i == 0 || i == len(parameters)-1 {
-				continue
-			}
-
-			rawString += parameter + ","
-		}
-	}
-	if rawString == "" {
-		rawString = parameters[1]
-	}
-	parameters = []string{parameters[0], strings.TrimRight(rawString, ","), parameters[len(parameters)-1]}
 	if len(parameters) != 3 {
 		return errors.Errorf("Set expected 3 parameters but got: %v", len(parameters))
 	}
@@ -1122,27 +2104,88 @@ func (d DataAPIService) Set(params string) interface{} {
 	// Set the EvalCache to the returned value of Parameter 1
 	// Ensure the returned data type aligns with Parameter 2
 	// This sounds weird, but read it a couple of times with the code
-	variable := strings.TrimSpace(parameters[0])
-	value := strings.TrimSpace(parameters[1])
-	variableType := strings.TrimSpace(parameters[2])
+	variable := strings.TrimSpace(parameters[0].String())
+	value := parameters[1]
+	variableType := strings.TrimSpace(parameters[2].String())
 	if variableType == "string" {
 		value, err := d.EvalString(value)
 		if err != nil {
 			return err
 		}
-		d.EvalCache[variable] = value
+		d.scope().Set(variable, value)
 	} else if variableType == "int" {
 		value, err := d.EvalInt(value)
 		if err != nil {
 			return err
 		}
-		d.EvalCache[variable] = value
+		d.scope().Set(variable, value)
+	} else if variableType == "float" || variableType == "decimal" {
+		value, err := d.EvalNode(value)
+		if err != nil {
+			return err
+		}
+		number, err := toNumber(value, variableType)
+		if err != nil {
+			return err
+		}
+		d.scope().Set(variable, number)
 	} else if variableType == "boolean" {
 		value, err := d.EvalBool(value)
 		if err != nil {
 			return err
 		}
-		d.EvalCache[variable] = value
+		d.scope().Set(variable, value)
+	} else if variableType == "list" || variableType == "[]string" || variableType == "[]int" {
+		value, err := d.EvalNode(value)
+		if err != nil {
+			return err
+		}
+		var list interface{}
+		switch variableType {
+		case "list":
+			list, err = toList(value)
+		case "[]string":
+			list, err = toStrings(value)
+		case "[]int":
+			list, err = toInts(value)
+		}
+		if err != nil {
+			return err
+		}
+		d.scope().Set(variable, list)
+	} else if variableType == "json" || variableType == "map" {
+		value, err := d.EvalNode(value)
+		if err != nil {
+			return err
+		}
+		if res, ok := value.(Response); ok {
+			value = res.value()
+		}
+		if raw, ok := value.(string); ok {
+			value, err = parseJSON(raw)
+			if err != nil {
+				return errors.Wrapf(err, "could not parse %v as JSON", variable)
+			}
+		}
+		if _, ok := value.(map[string]interface{}); !ok && variableType == "map" {
+			return errors.Errorf("%v is not a JSON object", value)
+		}
+		d.scope().Set(variable, value)
+	} else if variableType == "time" || variableType == "duration" {
+		value, err := d.EvalNode(value)
+		if err != nil {
+			return err
+		}
+		var converted interface{}
+		if variableType == "time" {
+			converted, err = toTime(value)
+		} else {
+			converted, err = toDuration(value)
+		}
+		if err != nil {
+			return err
+		}
+		d.scope().Set(variable, converted)
 	} else {
 		return errors.Errorf("variableType \"%v\" does not exist", variableType)
 	}
@@ -1151,3 +2194,284 @@ func (d DataAPIService) Set(params string) interface{} {
 	return nil
 
 }
+
+// Sleep will sleep for X seconds
+// Usage: [Sleep(0)]
+// Eg: [Sleep(5)]
+// Parameter 0: the amount of seconds you want to sleep
+// Eg: 5
+// Sleep is woken up to fail when the evaluation is cancelled or times out
+func (d DataAPIService) Sleep(parameters []Node) interface{} {
+
+	// Gets parameter 0
+	if len(parameters) != 1 {
+		return errors.Errorf("Sleep expected 1 parameter but got: %v", len(parameters))
+	}
+	seconds, err := d.EvalInt(parameters[0])
+	if err != nil {
+		return err
+	}
+
+	// Sleep ZZZzzz...
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-d.context().Done():
+		return d.done()
+	}
+
+	return nil
+
+}
+
+// Split will return the parts of a string separated by a separator as a list
+// Usage: [Split(0, 1)]
+// Eg: [ForEach(part, [Split(voucher, "-")], [PrintF("%v", part)])]
+// Parameter 0: the string to split
+// Eg: voucher
+// Parameter 1: the separator
+// Eg: "-"
+func (d DataAPIService) Split(s string, sep string) []interface{} {
+
+	parts := strings.Split(s, sep)
+	out := make([]interface{}, len(parts))
+	for i, part := range parts {
+		out[i] = part
+	}
+
+	return out
+
+}
+
+// Substr will return part of a string
+// Usage: [Substr(0, 1)] or [Substr(0, 1, 2)]
+// Eg: [Set(prefix, [Substr(voucher, 0, 3)], string)]
+// Parameter 0: the string
+// Eg: voucher
+// Parameter 1: the index of the first character, starting at 0
+// Eg: 0
+// Parameter 2: optional, the number of characters, the rest of the string is returned by default
+// Eg: 3
+func (d DataAPIService) Substr(s string, start int, length int) (string, error) {
+
+	chars := []rune(s)
+	if length < 0 {
+		length = len(chars) - start
+	}
+	if start < 0 || length < 0 || start+length > len(chars) {
+		return "", errors.Errorf("Substr(%v, %v) is out of range for %q", start, length, s)
+	}
+
+	return string(chars[start : start+length]), nil
+
+}
+
+// Switch will run the code of the case that is equal to a value
+// Usage: [Switch(0, 1, 2, 3, 4...)]
+// Eg: [Switch(code, -22, [PrintF("Not found")], 0, [PrintF("Passed")], [PrintF("Unknown code %v", code)])]
+// Parameter 0: the value to compare to every case
+// Eg: code
+// Parameters 1++: pairs of a case value and the code that runs if the case equals parameter 0
+// Only the code of the first case that matches runs
+// Eg: -22, [PrintF("Not found")]
+// Last parameter: optional, the code that runs when no case matches
+// Eg: [PrintF("Unknown code %v", code)]
+// Failures inside a branch are reported under the case that ran, or "default"
+func (d DataAPIService) Switch(parameters []Node) interface{} {
+
+	// Gets parameter 0
+	if len(parameters) < 3 {
+		return errors.Errorf("Switch expected at least 3 parameters but got: %v", len(parameters))
+	}
+	val, err := d.EvalNode(parameters[0])
+	if err != nil {
+		return err
+	}
+
+	// Run the code of the first case that is equal to the value
+	cases := parameters[1:]
+	for i := 0; i+1 < len(cases); i += 2 {
+		c, err := d.EvalNode(cases[i])
+		if err != nil {
+			return err
+		}
+		equal, err := binaryOp("==", val, c)
+		if err != nil {
+			return err
+		}
+		if boolean, _ := equal.(bool); boolean {
+			return d.branch("case "+cases[i].String(), cases[i+1])
+		}
+	}
+
+	// Run the default branch if there is one
+	if len(cases)%2 == 1 {
+		return d.branch("default", cases[len(cases)-1])
+	}
+
+	// Return success
+	return nil
+
+}
+
+// Timeout will fail if the code in parameter 1 does not finish within the given number of seconds
+// Usage: [Timeout(0, 1)] or [Timeout(0)]
+// Eg: [Timeout(5, [Post(url, jsonBody, headers)][AssertSuccess()])]
+// Parameter 0: the number of seconds the code may run for, which may have a fraction
+// Eg: 5 or 0.5
+// Parameter 1: the code that must finish in time
+// Eg: [Post(url, jsonBody, headers)][AssertSuccess()]
+// Without parameter 1 Timeout is a header that limits how long the rest of the file may run for
+// Eg: [Timeout(30)]
+// Sleep, Post and ParallelPost are stopped as soon as the time runs out
+// The code that was cut short is marked as timed out in the report
+func (d DataAPIService) Timeout(parameters []Node) interface{} {
+
+	// Gets parameters 0 and 1
+	if len(parameters) != 2 {
+		return errors.New("Timeout without a body can only be used as the header of a file")
+	}
+	limit, err := d.evalSeconds(parameters[0])
+	if err != nil {
+		return err
+	}
+
+	// Run the code with a deadline
+	local, cancel := d.withTimeout(limit)
+	defer cancel()
+	_, err = local.EvalNode(parameters[1])
+	if err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+
+}
+
+// Trim will return the string without leading and trailing white space
+// Usage: [Trim(0)] or [Trim(0, 1)]
+// Eg: [Set(id, [Trim(body.ID)], string)]
+// Parameter 0: the string
+// Eg: body.ID
+// Parameter 1: optional, the characters to trim instead of white space
+// Eg: "0"
+func (d DataAPIService) Trim(s string, cutset string) string {
+	if cutset == "" {
+		return strings.TrimSpace(s)
+	}
+	return strings.Trim(s, cutset)
+}
+
+// Try will run the code in parameter 0 and run the code in the last parameter if it fails
+// The failure of parameter 0 is not reported, only failures of the catch code are
+// Usage: [Try(0, 1)] or [Try(0, 1, 2)]
+// Eg: [Try([Post(url, jsonBody, headers)], [PrintF("Post failed: %v", err)])]
+// Eg: [Try([Post(url, jsonBody, headers)], e, [AssertContains(e, "connection refused")])]
+// Parameter 0: the code to try
+// Eg: [Post(url, jsonBody, headers)]
+// Parameter 1: optional, the variable that holds the error message, "err" if not given
+// Eg: e
+// Parameter 2: the catch code that runs if parameter 0 fails
+// Eg: [AssertContains(e, "connection refused")]
+func (d DataAPIService) Try(parameters []Node) interface{} {
+
+	// Gets parameters 0 and 2 and the optional parameter 1
+	if len(parameters) != 2 && len(parameters) != 3 {
+		return errors.Errorf("Try expected 2 or 3 parameters but got: %v", len(parameters))
+	}
+	variable := "err"
+	if len(parameters) == 3 {
+		variable = strings.TrimSpace(parameters[1].String())
+	}
+	catch := parameters[len(parameters)-1]
+
+	// Run the code, nothing else happens if it passes
+	_, err := d.EvalNode(parameters[0])
+	if _, ok := err.(*Signal); ok || err == nil {
+		return err
+	}
+
+	// Run the catch code in a new block scope that holds the error message
+	local := d
+	local.Scope = NewBlockScope(d.scope())
+	local.Scope.Define(variable, err.Error())
+	return local.branch("catch", catch)
+
+}
+
+// URLEncode will return the value escaped for use in a URL
+// Usage: [URLEncode(0)]
+// Eg: [Post("{{url}}?ref={{[URLEncode(reference)]}}", body, headers)]
+// Parameter 0: a string to escape, or a map to encode as a query string with its keys in order
+// Eg: reference or query
+// The above map {"b": "x y", "a": 1} will be encoded as a=1&b=x+y
+func (d DataAPIService) URLEncode(v interface{}) (string, error) {
+
+	if s, ok := v.(string); ok {
+		return url.QueryEscape(s), nil
+	}
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return "", errors.Errorf("%v is not a string or map", v)
+	}
+	query := url.Values{}
+	for key, val := range object {
+		query.Set(key, fmt.Sprintf("%v", val))
+	}
+
+	return query.Encode(), nil
+
+}
+
+// UUID will return a random version 4 UUID
+// Usage: [UUID()]
+// Eg: [Set(reference, [UUID()], string)]
+// The UUID is repeatable with the seed of the run
+func (d DataAPIService) UUID() (string, error) {
+
+	id, err := uuid.NewRandomFromReader(d.withRun().Run)
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+
+}
+
+// Upper will return the string in upper case
+// Usage: [Upper(0)]
+// Eg: [Set(currency, [Upper(currency)], string)]
+// Parameter 0: the string
+// Eg: currency
+func (d DataAPIService) Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// While will run the code in parameter 1 for as long as parameter 0 is true
+// Usage: [While(0, 1)]
+// Eg: [While(attempts < 3, [Post(url, body, headers)][If(res != "pending", [Break()])][Set(attempts, attempts+1, int)])]
+// Parameter 0: is the condition that will break the loop
+// Eg: attempts < 3
+// Parameter 1: is the code that runs inside the loop
+// Eg: [Post(url, body, headers)][Set(attempts, attempts+1, int)]
+// [Break()] and [Continue()] can be used inside the code to stop the loop or move to the next iteration
+// The loop fails once it has run the maximum number of iterations a loop may run, which is 10000 by default
+func (d DataAPIService) While(parameters []Node) interface{} {
+
+	// Gets parameters 0 and 1
+	if len(parameters) != 2 {
+		return errors.Errorf("While expected 2 parameters but got: %v", len(parameters))
+	}
+
+	// Run the expression in parameter 1 until parameter 0 returns false
+	err := d.loop("While", parameters[0], parameters[1])
+	if err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+
+}
@@ -0,0 +1,751 @@
+package dataapi_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Celbux/dataapi/business/dataapi"
+	"github.com/Celbux/dataapi/foundation/tools"
+	"github.com/pkg/errors"
+)
+
+func TestEvalSetJSONString(t *testing.T) {
+	t.Log("should set a string that contains brackets, commas and parenthesis")
+
+	service, _ := newService()
+	_, err := service.Eval(context.Background(), `[Set(json, "{\"Data\": [1, 2], \"Text\": \"(a, b)]\"}", string)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, `{"Data": [1, 2], "Text": "(a, b)]"}`, service.EvalCache["json"].(string))
+}
+
+func TestEvalForIf(t *testing.T) {
+	t.Log("should run the for loop body while the condition holds")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(i, 0, int)][For(i < 5, [If(i%2 == 0, [PrintF("%v, %v", "even", i)])][Set(i, i+1, int)])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "even, 0\neven, 2\neven, 4\n", buf.String())
+	assertInt(t, 5, service.EvalCache["i"].(int))
+}
+
+func TestEvalErrors(t *testing.T) {
+	t.Log("should return the errors of every failing call in a block")
+
+	service, _ := newService()
+	_, err := service.Eval(context.Background(), `[Fail("first")][Set(i, 1, int)][AssertEquals(i, 2)]`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertString(t, "first, Expected 2 but got 1", err.Error())
+}
+
+func TestEvalControlFlow(t *testing.T) {
+	t.Log("should stop loops with Break, skip iterations with Continue and leave functions with Return")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(i, 0, int)]` +
+		`[While(true, [Set(i, i+1, int)][If(i == 2, [Continue()])][If(i > 4, [Break()])][PrintF("%v", i)])]` +
+		`[Func(sign, (n), [If(n < 0, [Return("negative")])][Return("positive")], "unreachable")]` +
+		`[PrintF("%v %v", [sign(-1)], [sign(1)])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "1\n3\n4\nnegative positive\n", buf.String())
+}
+
+func TestEvalForEach(t *testing.T) {
+	t.Log("should iterate over lists, JSON arrays and strings delimited by ___")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[ForEach(item, (1, 2), [PrintF("%v", item)])]` +
+		`[Set(res, "[{\"ID\": 3}, 4.5]", string)][ForEach(item, res, [PrintF("%v", item)])]` +
+		`[ForEach(i, item, "a___b___c", [If(item == "b", [Continue()])][PrintF("%v %v", i, item)])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "1\n2\nmap[ID:3]\n4.5\n0 a\n2 c\n", buf.String())
+	if _, ok := service.EvalCache["item"]; ok {
+		t.Error("expected item to only be defined inside the loop")
+	}
+}
+
+func TestEvalLists(t *testing.T) {
+	t.Log("should set, index, append to and search native lists")
+
+	service, _ := newService()
+	_, err := service.Eval(context.Background(), `[Set(a, [1, 2], list)][Set(a, [Append(a, 3)], list)]` +
+		`[Set(ids, "4___5", []int)][Set(names, ["x", 1], []string)]` +
+		`[AssertEquals(a[2] + ids[1] + [Len(a)], 11)][AssertEquals([Contains(names, "1")], true)]` +
+		`[AssertStringArrEquals(a, "3___1___2", false)][AssertEquals([Len("héllo")], 5)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{"x", "1"}, service.EvalCache["names"].([]string))
+	_, err = service.Eval(context.Background(), `a[3]`)
+	assertString(t, "index 3 out of range for list of length 3", err.Error())
+}
+
+func TestEvalJSON(t *testing.T) {
+	t.Log("should parse JSON into maps and read nested fields with selectors and indexes")
+
+	service, _ := newService()
+	service.EvalCache["res"] = `{"Failures": ["a.txt: failed"], "Error": {"Code": -22}}`
+	_, err := service.Eval(context.Background(), `[Set(body, res, json)][AssertEquals(body.Failures[0], "a.txt: failed")]` +
+		`[AssertEquals(res["Error"].Code, -22)][AssertEquals([Len(body)], 2)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Eval(context.Background(), `body.Successes`)
+	assertString(t, "field Successes not found", err.Error())
+	_, err = service.Eval(context.Background(), `[Set(m, "[1]", map)]`)
+	assertString(t, "[1] is not a JSON object", err.Error())
+}
+
+func TestEvalDecimals(t *testing.T) {
+	t.Log("should do exact decimal arithmetic and keep the decimal places of money amounts")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(before, "20.00", decimal)][Set(amount, 5.5, decimal)][Set(after, 14.5, float)]` +
+		`[AssertEquals(before - amount, after)][AssertEquals(0.1 + 0.2 == 0.3, true)]` +
+		`[PrintF("%v %v %v", before - amount, amount * 2, 1.0 / 3)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "14.50 11.0 0.3333333333333333\n", buf.String())
+	_, err = service.Eval(context.Background(), `[AssertEquals(before, 20.01)]`)
+	assertString(t, "Expected 20.01 but got 20.00", err.Error())
+
+	service.EvalCache["inf"] = math.Inf(1)
+	_, err = service.Eval(context.Background(), `[Set(total, before + inf, decimal)]`)
+	assertString(t, "+Inf is not a decimal", err.Error())
+	_, err = dataapi.DecimalFromFloat(math.NaN())
+	assertString(t, "NaN is not a decimal", err.Error())
+}
+
+func TestEvalTemplates(t *testing.T) {
+	t.Log("should fill in the placeholders of string literals from the current scope")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(name, "World", string)][Set(res, "{\"Reference\": \"R1\"}", json)][Set(ids, [1, 2], list)]` +
+		`[PrintF("Hello {{name}} {{res.Reference}} {{res[\"Reference\"]}} \{{name}} {{ids}}")]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "Hello World R1 R1 {{name}} [1,2]\n", buf.String())
+	_, err = service.Eval(context.Background(), `"{{missing}}"`)
+	assertString(t, "variable missing is not defined", err.Error())
+}
+
+func TestEvalExpectFailTry(t *testing.T) {
+	t.Log("should pass when code fails with the expected error and expose the error to the catch code")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[ExpectFail([AssertEquals(1, 2)], "Expected 2 but got 1")]` +
+		`[ExpectFail([Fail("code -22")], "code -[0-9]+")]` +
+		`[Try([Fail("boom")], [PrintF("caught %v", err)])][Try([Pass()], e, [PrintF("unreachable")])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "caught boom\n", buf.String())
+
+	_, err = service.Eval(context.Background(), `[ExpectFail([Pass()], "boom")]`)
+	assertString(t, "expected [Pass()] to fail with \"boom\" but it passed", err.Error())
+	_, err = service.Eval(context.Background(), `[ExpectFail([Fail("bang")], "boom")]`)
+	assertString(t, "expected [Fail(\"bang\")] to fail with \"boom\" but it failed with: bang", err.Error())
+	_, err = service.Eval(context.Background(), `[Try([Fail("boom")], e, [AssertEquals(e, "bang")])]`)
+	assertString(t, "Expected bang but got boom", err.Error())
+}
+
+func TestEvalLimits(t *testing.T) {
+	t.Log("should stop loops and runs that exceed their limits with a clear failure")
+
+	service, _ := newService()
+	service.Limits = dataapi.Limits{MaxIterations: 50, MaxSteps: 1000}
+	_, err := service.Eval(context.Background(), `[Set(i, 0, int)][For(i < 10, [Set(i, i, int)])]`)
+	assertString(t, "For loop stopped after reaching the limit of 50 iterations", err.Error())
+	_, err = service.Eval(context.Background(), `[Set(i, 0, int)][While(i < 40, [Set(i, i+1, int)])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.Eval(context.Background(), `[Func(loop, (n), [loop(n+1)])][loop(0)]`)
+	assertString(t, "run stopped after reaching the limit of 1000 evaluated expressions", err.Error())
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[While(true, [Pass()])]\n[Set(i, 0, int)]\n[Set(j, 0, int)]\n",
+	})
+	service.Limits = dataapi.Limits{MaxIterations: 5000, MaxSteps: 100}
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	assertInt(t, 1, len(report.Nodes))
+}
+
+func TestEvalRandom(t *testing.T) {
+	t.Log("should generate the same random data for runs with the same seed")
+
+	service, _ := newService()
+	service.Seed = 42
+	expression := `[Set(a, [RandomInt(1, 6)], int)][Set(b, [RandomString(8, "abc")], string)]` +
+		`[Set(c, [RandomChoice(["x", "y", "z"])], string)][Set(d, [UUID()], string)]` +
+		`[Set(e, [Sequence("ref")], int)][Set(f, [Sequence("ref")], int)]`
+	var runs [][]string
+	for i := 0; i < 2; i++ {
+		_, err := service.Eval(context.Background(), expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var run []string
+		for _, name := range []string{"a", "b", "c", "d"} {
+			run = append(run, fmt.Sprint(service.EvalCache[name]))
+		}
+		runs = append(runs, run)
+		assertInt(t, 1, service.EvalCache["e"].(int))
+		assertInt(t, 2, service.EvalCache["f"].(int))
+	}
+	assertStrings(t, runs[0], runs[1])
+	assertInt(t, 8, len(runs[0][1]))
+	assertInt(t, 36, len(runs[0][3]))
+
+	_, err := service.Eval(context.Background(), `[RandomInt(6, 1)]`)
+	assertString(t, "RandomInt expected min 6 to be at most max 1", err.Error())
+	_, err = service.Eval(context.Background(), `[RandomInt(-1, 9223372036854775807)]`)
+	assertString(t, "RandomInt range from -1 to 9223372036854775807 is too large", err.Error())
+
+	report := service.Evaluate(context.Background(), "missing.txt")
+	if report["seed"].(int64) != 42 {
+		t.Errorf("expected the seed of the run to be 42 but got: %v", report["seed"])
+	}
+}
+
+func TestEvalTime(t *testing.T) {
+	t.Log("should format, parse and add to times using the frozen clock of the run")
+
+	service, buf := newService()
+	service.Clock = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	_, err := service.Eval(context.Background(), `[Set(ttl, "24h", duration)]` +
+		`[Set(expiry, [Now()] + ttl, time)][PrintF("%v", expiry)]` +
+		`[PrintF("%v", [FormatTime([AddDuration(expiry, "-1h30m")], "DateTime")])]` +
+		`[PrintF("%v", [Now("unix")])]` +
+		`[Set(created, [ParseTime("2021-06-01 10:00:03", "DateTime")], time)]` +
+		`[AssertWithin(created, [Now()], "5s")][AssertEquals(expiry > created, true)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "2021-06-02T10:00:00Z\n2021-06-02 08:30:00\n1622541600\n", buf.String())
+
+	_, err = service.Eval(context.Background(), `[AssertWithin("2021-06-01T10:00:10Z", [Now()], "5s")]`)
+	assertString(t, "expected 2021-06-01T10:00:10Z to be within 5s of 2021-06-01T10:00:00Z but it was 10s apart", err.Error())
+	_, err = service.Eval(context.Background(), `[ParseTime("01/06/2021", "Date")]`)
+	assertString(t, "01/06/2021 does not match the time layout Date", err.Error())
+}
+
+func TestEvalCrypto(t *testing.T) {
+	t.Log("should hash, sign and encode values for signed requests")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[PrintF("%v", [SHA256("abc")])]` +
+		`[PrintF("%v", [HMAC("SHA256", "key", "The quick brown fox jumps over the lazy dog")])]` +
+		`[PrintF("%v %v", [Base64Encode("user:pass")], [Base64Decode("dXNlcjpwYXNz")])]` +
+		`[PrintF("%v %v", [HexEncode("hi")], [URLEncode("a b&c")])]` +
+		`[Set(claims, "{\"sub\": \"wallet1\", \"exp\": 1622541600}", map)]` +
+		`[Set(token, [JWTSign(claims, "secret", "HS256")], string)]` +
+		`[Set(decoded, [JWTDecode(token)], map)][PrintF("%v %v", decoded.sub, decoded.exp)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad\n" +
+		"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8\n" +
+		"dXNlcjpwYXNz user:pass\n6869 a+b%26c\nwallet1 1622541600\n", buf.String())
+	assertContains(t, "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.", service.EvalCache["token"].(string))
+
+	_, err = service.Eval(context.Background(), `[HMAC("MD5", "key", "msg")]`)
+	assertString(t, "hash algorithm MD5 does not exist, use SHA1, SHA256, SHA384 or SHA512", err.Error())
+}
+
+func TestEvalStrings(t *testing.T) {
+	t.Log("should manipulate strings and pull values out of them with regular expressions")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(res, "Voucher 117-22427-719752 issued", string)]` +
+		`[Set(voucher, [Extract(res, "Voucher ([0-9-]+) issued")], string)][AssertMatches(voucher, "^[0-9]{3}-[0-9]{5}-[0-9]{6}$")]` +
+		`[Set(parts, [Split(voucher, "-")], list)][PrintF("%v %v", [Len(parts)], [Join(parts, "/")])]` +
+		`[PrintF("%v|%v|%v", [Replace(voucher, "-", "")], [Substr(voucher, 4, 5)], [Substr(voucher, 10)])]` +
+		`[PrintF("%v|%v|%v", [Trim("  Store1 ")], [Upper("zar")], [Lower("SUCCESS")])]` +
+		`[PrintF("%v %v %v", [Format("REF-%04d", 7)], [Match(voucher, "^117-")], [Extract(res, "[0-9]+")])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "3 117/22427/719752\n11722427719752|22427|719752\nStore1|ZAR|success\nREF-0007 true 117\n", buf.String())
+
+	_, err = service.Eval(context.Background(), `[AssertMatches("117-2242", "^[0-9]{3}-[0-9]{5}$")]`)
+	assertString(t, `expected "117-2242" to match ^[0-9]{3}-[0-9]{5}$`, err.Error())
+	_, err = service.Eval(context.Background(), `[Extract("no voucher", "([0-9]+)")]`)
+	assertString(t, `"no voucher" does not match ([0-9]+)`, err.Error())
+}
+
+func TestEvalFunc(t *testing.T) {
+	t.Log("should call a user defined function with its parameters bound in a local scope")
+
+	service, buf := newService()
+	_, err := service.Eval(context.Background(), `[Set(a, "global", string)]` +
+		`[Func(greet, (a, b), [PrintF("%v %v", a, b)][Set(c, a + b, string)], c)]` +
+		`[Set(res, [greet("hello", "world")], string)][PrintF("%v", a)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "hello world\nglobal\n", buf.String())
+	assertString(t, "helloworld", service.EvalCache["res"].(string))
+	if _, ok := service.EvalCache["c"]; ok {
+		t.Error("expected c to only be defined inside the function")
+	}
+}
+
+func TestEvalFuncErrors(t *testing.T) {
+	t.Log("should fail when a user defined function is declared with invalid parameters or called with the wrong number of them")
+
+	service, _ := newService()
+	_, err := service.Eval(context.Background(), `[Func(noop, (), [Pass("")])][noop(1)]`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assertString(t, "noop expected 0 parameters but got: 1", err.Error())
+
+	_, err = service.Eval(context.Background(), `[Func(Set, (a), [Pass("")])]`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assertString(t, "Func can not redefine the data function Set", err.Error())
+
+	_, err = service.Eval(context.Background(), `[Func(add, (a, a), [Pass("")])]`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assertString(t, "parameter a of add is declared more than once", err.Error())
+}
+
+func TestEvaluateReport(t *testing.T) {
+	t.Log("should add every statement of the evaluated file to the report")
+
+	writeScripts(t, map[string]string{
+		"main.txt":  "[Evaluate(\"child.txt\")]\n[Pass(\"\")]\n",
+		"child.txt": "[Set(s, \"a]b\", string)]\n[AssertEquals(s, \"a]c\")]\n",
+	})
+	service, _ := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{
+		"main.txt: child.txt",
+		"child.txt: child.txt:2:1: [AssertEquals(s, \"a]c\")]",
+		"child.txt:2:1: [AssertEquals(s, \"a]c\")]: Expected a]c but got a]b",
+	}, failures)
+}
+
+func TestEvaluateReportPositions(t *testing.T) {
+	t.Log("should report the position of duplicate lines and calls nested inside a for loop")
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[Fail(\"dup\")]\n[Fail(\"dup\")]\n[Set(i, 0, int)]\n" +
+			"[For(i < 1, [Set(i, i+1, int)]\n    [AssertEquals(i, 2)])]\n",
+	})
+	service, _ := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{
+		"main.txt: main.txt:1:1: [Fail(\"dup\")]",
+		"main.txt:1:1: [Fail(\"dup\")]: dup",
+		"main.txt: main.txt:2:1: [Fail(\"dup\")]",
+		"main.txt:2:1: [Fail(\"dup\")]: dup",
+		"main.txt: main.txt:4:1: [For(i < 1, [Set(i, i+1, int)]\n    [AssertEquals(i, 2)])]",
+		"main.txt:4:1: [For(i < 1, [Set(i, i+1, int)]\n    [AssertEquals(i, 2)])]: main.txt:5:5: [AssertEquals(i, 2)]",
+		"main.txt:5:5: [AssertEquals(i, 2)]: Expected 2 but got 1",
+	}, failures)
+}
+
+func TestEvaluateBranches(t *testing.T) {
+	t.Log("should run the matching branch of If, IfElse and Switch and report failures under the branch")
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[Set(code, -22, int)]\n" +
+			"[If(code == 0, [PrintF(\"then\")], [PrintF(\"else\")])]\n" +
+			"[IfElse(code == 0, [PrintF(\"zero\")], code < 0, [PrintF(\"negative\")], [PrintF(\"positive\")])]\n" +
+			"[Switch(code, 0, [PrintF(\"zero\")], -22, [PrintF(\"not found\")])]\n" +
+			"[If(code == 0, [Pass()], [Fail(\"bad code\")])]\n",
+	})
+	service, buf := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "main.txt\nelse\nnegative\nnot found\n", buf.String())
+	assertStrings(t, []string{
+		"main.txt: main.txt:5:1: [If(code == 0, [Pass()], [Fail(\"bad code\")])]",
+		"main.txt:5:1: [If(code == 0, [Pass()], [Fail(\"bad code\")])]: main.txt:5:26: else: [Fail(\"bad code\")]",
+		"main.txt:5:26: else: [Fail(\"bad code\")]: bad code",
+	}, failures)
+}
+
+func TestEvalCore(t *testing.T) {
+	t.Log("should call core functions on the configured core and normalise their responses as res")
+
+	core := dataapi.NewFakeCore()
+	core.Handle("Pay", func(args []interface{}) ([]string, error) {
+		if args[1].(int) > 1000 {
+			return []string{"-22", "insufficient funds"}, nil
+		}
+		return []string{"1", "paid"}, nil
+	})
+	service, _ := newService()
+	service.Core = core
+
+	_, err := service.Eval(context.Background(), `[Pay("117-22427-719752", 500)][AssertSuccess()]` +
+		`[Pay("117-22427-719752", 2000)][AssertFailure("-22")][AssertEquals(res[1], "insufficient funds")]` +
+		`[AssertEquals(res.Success, false)][AssertEquals([Pay("117-22427-719752", 1)].Code, "")]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInt(t, 3, len(core.Calls()))
+	assertString(t, "Pay", core.Calls()[1].Name)
+
+	_, err = service.Eval(context.Background(), `[Pay("117-22427-719752", 2000)][AssertSuccess()]`)
+	assertString(t, `expected success but failed with core res[]: ["-22","insufficient funds"]`, err.Error())
+	_, err = service.Eval(context.Background(), `[Refund("117-22427-719752")]`)
+	assertString(t, "data function Refund not found", err.Error())
+}
+
+func TestRegistry(t *testing.T) {
+	t.Log("should call data functions registered with typed parameters and check their arity")
+
+	registry := dataapi.NewRegistry()
+	err := registry.Register("Repeat", func(d dataapi.DataAPIService, args []interface{}) (interface{}, error) {
+		n := 1
+		if len(args) == 2 {
+			n = args[1].(int)
+		}
+		return strings.Repeat(args[0].(string), n), nil
+	}, dataapi.Signature{
+		Params: []dataapi.Param{{Name: "s", Type: dataapi.TypeString}, {Name: "n", Type: dataapi.TypeInt, Optional: true}},
+		Help:   "Repeat returns s repeated n times",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, _ := newService()
+	service.Registry = registry
+
+	_, err = service.Eval(context.Background(), `[AssertEquals([Repeat("ab", 1+1)], "abab")]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.Eval(context.Background(), `[Repeat("ab", 1, 2)]`)
+	assertString(t, "Repeat expected 1 to 2 parameters but got: 3", err.Error())
+	out, err := service.Eval(context.Background(), `[Help("Repeat")]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "Repeat(s string, [n int])\nRepeat returns s repeated n times", out["val"].(string))
+	err = registry.Register("Set", nil, dataapi.Signature{})
+	assertString(t, "data function Set has no implementation", err.Error())
+}
+
+func TestCheck(t *testing.T) {
+	t.Log("should report problems in data code without running it")
+
+	writeScripts(t, map[string]string{
+		"lib.txt": "[Func(greet, (name), [PrintF(\"%v %v\", greeting, name)])]\n[Set(greeting, \"hello\", string)]\n",
+		"main.txt": "[Import(\"lib.txt\")]\n[PrintF(\"running\")]\n[greet(\"a\", \"b\")]\n" +
+			"[AssertEqual(1, 1)]\n[Set(x, 1, integer)]\n[PrintF(\"{{y}}\")]\n[ForEach(item, [1], [PrintF(\"%v\", item)])]\n" +
+			"[Evaluate(\"missing.txt\")]\n[Set(z, 1, int)][Sleep(z, z)]\n[If(true, [Pass()]\n[Set(z, 1, int)]\n",
+	})
+	service, buf := newService()
+
+	problems := service.Check("main.txt")
+
+	assertStrings(t, []string{
+		"main.txt:10:1: unbalanced brackets, \"[\" is never closed",
+		"main.txt:3:1: greet expected 1 parameters but got: 2",
+		"main.txt:4:1: data function AssertEqual not found",
+		"main.txt:5:12: variableType \"integer\" does not exist",
+		"main.txt:6:12: variable y is not defined",
+		"main.txt:8:11: could not read missing.txt: stat missing.txt: no such file or directory",
+		"main.txt:9:17: Sleep expected 1 parameters but got: 2",
+	}, problems)
+	assertString(t, "", buf.String())
+
+	writeScripts(t, map[string]string{
+		"funcs.txt": "[Func(pair, (a, a), [Pass()])]\n[pair(1, 2)]\n[Try([Fail(\"x\")], e, [PrintF(\"%v %v\", e, err)])]\n",
+	})
+	assertStrings(t, []string{
+		"funcs.txt:1:17: parameter a of pair is declared more than once",
+		"funcs.txt:3:42: variable err is not defined",
+	}, service.Check("funcs.txt"))
+
+	writeScripts(t, map[string]string{
+		"posts.txt": "[ParallelPost([\"a.txt\"], [[\"Monkey: Madness\"]], [\"{}\"], [\"http://localhost\"])]\n" +
+			"[PrintF(\"%v %v\", ParallelPost0, ParallelPost1)]\n" +
+			"[Set(urls, [\"http://localhost\"], list)][ParallelPost(urls, urls, urls, urls)][PrintF(\"%v\", ParallelPost7)]\n",
+	})
+	assertStrings(t, []string{
+		"posts.txt:2:33: variable ParallelPost1 is not defined",
+	}, service.Check("posts.txt"))
+}
+
+func TestEvaluateImport(t *testing.T) {
+	t.Log("should import library definitions once without adding the library to the report")
+
+	writeScripts(t, map[string]string{
+		"lib/greet.txt": "[PrintF(\"loading\")]\n[Set(greeting, \"hello\", string)]\n" +
+			"[Func(greet, (name), [Set(out, greeting + \" \" + name, string)], out)]\n",
+		"main.txt": "[Import(\"lib/greet.txt\")]\n[Import(\"lib/greet.txt\")]\n" +
+			"[AssertEquals([greet(\"world\")], \"hello world\")]\n",
+	})
+	service, buf := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertInt(t, 0, len(failures))
+	assertInt(t, 3, len(report.Nodes))
+	assertString(t, "main.txt\nloading\n", buf.String())
+
+	err = service.Import("lib/greet.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvaluateImportCycle(t *testing.T) {
+	t.Log("should fail to import libraries that import each other")
+
+	writeScripts(t, map[string]string{
+		"a.txt":    "[Import(\"b.txt\")]\n",
+		"b.txt":    "[Import(\"a.txt\")]\n",
+		"main.txt": "[Import(\"a.txt\")]\n",
+	})
+	service, _ := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{
+		"main.txt: main.txt:1:1: [Import(\"a.txt\")]",
+		"main.txt:1:1: [Import(\"a.txt\")]: a.txt:1:1: [Import(\"b.txt\")]",
+		"a.txt:1:1: [Import(\"b.txt\")]: b.txt:1:1: [Import(\"a.txt\")]",
+		"b.txt:1:1: [Import(\"a.txt\")]: import cycle: a.txt -> b.txt -> a.txt",
+	}, failures)
+}
+
+func TestEvaluateParams(t *testing.T) {
+	t.Log("should bind named parameters in the Evaluated file and validate them against its Params header")
+
+	writeScripts(t, map[string]string{
+		"payments/pay.txt": "[Params(storeID, amount=100)]\n[PrintF(\"%v %v\", storeID, amount)]\n",
+		"main.txt": "[Evaluate(\"payments/pay.txt\", storeID=\"Store1\", amount=2000)]\n" +
+			"[Evaluate(\"payments/pay.txt\", storeID=\"Store\" + \"2\")]\n" +
+			"[Evaluate(\"payments/pay.txt\", amount=1)]\n" +
+			"[Evaluate(\"payments/pay.txt\", storeID=\"Store3\", currency=\"ZAR\")]\n",
+	})
+	service, buf := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "main.txt\npayments/pay.txt\nStore1 2000\npayments/pay.txt\nStore2 100\npayments/pay.txt\npayments/pay.txt\n", buf.String())
+	assertInt(t, 6, len(failures))
+	assertString(t, "configs/dataapi/payments/pay.txt(storeID=Store1, amount=2000)", report.Nodes[0].Data)
+	assertString(t, "main.txt: payments/pay.txt(amount=1)", failures[0])
+	assertContains(t, "missing required parameters: storeID", failures[2])
+	assertContains(t, "unknown parameters: currency", failures[5])
+	_, err = service.Eval(context.Background(), `[PrintF("%v", format="x")]`)
+	assertString(t, "PrintF does not accept named parameters", err.Error())
+}
+
+func TestEvaluateForEachRow(t *testing.T) {
+	t.Log("should run the body for every row of a data file and report on every row")
+
+	writeScripts(t, map[string]string{
+		"data/vouchers.csv":  "voucherNo,amount\n117-1,2000\n117-2,500\n117-3,700\n",
+		"data/vouchers.json": `[{"voucherNo": "117-1", "amount": 2000}, {"voucherNo": "117-2", "amount": 500}]`,
+		"data/rows.csv":      "row,amount\nfirst,1\n",
+		"main.txt": "[ForEachRow(\"data/vouchers.csv\", \"voucherNo\", [AssertEquals(amount, \"500\")])]\n" +
+			"[ForEachRow(\"data/vouchers.json\", [PrintF(\"%v %v\", voucherNo, amount+1)])]\n" +
+			"[ForEachRow(\"data/rows.csv\", [PrintF(\"%v %v\", row[\"row\"], row[\"amount\"])])]\n",
+	})
+	service, buf := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, "main.txt\n117-1 2001\n117-2 501\nfirst 1\n", buf.String())
+	assertInt(t, 3, len(report.Nodes[0].Nodes))
+	assertInt(t, 2, len(report.Nodes[1].Nodes))
+	assertStrings(t, []string{
+		"main.txt: main.txt:1:1: [ForEachRow(\"data/vouchers.csv\", \"voucherNo\", [AssertEquals(amount, \"500\")])]",
+		"main.txt:1:1: [ForEachRow(\"data/vouchers.csv\", \"voucherNo\", [AssertEquals(amount, \"500\")])]: voucherNo=117-1",
+		"voucherNo=117-1: main.txt:1:47: [AssertEquals(amount, \"500\")]",
+		"main.txt:1:47: [AssertEquals(amount, \"500\")]: Expected 500 but got 2000",
+		"main.txt:1:1: [ForEachRow(\"data/vouchers.csv\", \"voucherNo\", [AssertEquals(amount, \"500\")])]: voucherNo=117-3",
+		"voucherNo=117-3: main.txt:1:47: [AssertEquals(amount, \"500\")]",
+		"main.txt:1:47: [AssertEquals(amount, \"500\")]: Expected 500 but got 700",
+	}, failures)
+	assertString(t, "row 2", report.Nodes[1].Nodes[1].Data)
+}
+
+func TestEvaluateTimeout(t *testing.T) {
+	t.Log("should stop code that runs out of time or is cancelled and mark it as timed out in the report")
+
+	service, _ := newService()
+	_, err := service.Eval(context.Background(), `[Timeout(0.05, [Sleep(5)])]`)
+	assertString(t, "timed out after 50ms", err.Error())
+	_, err = service.Eval(context.Background(), `[Timeout(5, [Set(i, 1, int)])][AssertEquals(i, 1)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = service.Eval(ctx, `[Set(i, 1, int)]`)
+	assertString(t, "evaluation cancelled", err.Error())
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[Timeout(0.05)]\n[If(true, [Sleep(5)])]\n[PrintF(\"unreachable\")]\n",
+	})
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertInt(t, 2, len(report.Nodes))
+	assertStrings(t, []string{
+		"main.txt: main.txt:2:1: [If(true, [Sleep(5)])] (timed out)",
+		"main.txt:2:1: [If(true, [Sleep(5)])] (timed out): main.txt:2:11: then: [Sleep(5)] (timed out)",
+		"main.txt:2:11: then: [Sleep(5)] (timed out): timed out after 50ms",
+	}, failures)
+}
+
+func TestEvaluateScopes(t *testing.T) {
+	t.Log("should keep variables of evaluated files and loop bodies in their own scope")
+
+	writeScripts(t, map[string]string{
+		"child.txt": "[Set(i, 100, int)]\n[Set(token, \"abc\", string)]\n[Export(token)]\n" +
+			"[Global(count)]\n[Set(count, count+1, int)]\n",
+		"main.txt": "[Set(i, 0, int)]\n[Set(count, 0, int)]\n[Evaluate(\"child.txt\")]\n" +
+			"[For(i < 3, [Set(j, i, int)][Set(i, i+1, int)])]\n" +
+			"[AssertEquals(i, 3)]\n[AssertEquals(token, \"abc\")]\n[AssertEquals(count, 0)]\n" +
+			"[Res(\"j\")]\n",
+	})
+	service, _ := newService()
+	service.EvalCache["count"] = 10
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{
+		"main.txt: main.txt:8:1: [Res(\"j\")]",
+		"main.txt:8:1: [Res(\"j\")]: field j could not be found on the EvalCache",
+	}, failures)
+	assertInt(t, 11, service.EvalCache["count"].(int))
+}
+
+func TestEvaluateReturn(t *testing.T) {
+	t.Log("should stop evaluating a file on Return and fail on Break outside of a loop")
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[Break()]\n[Return()]\n[Fail(\"unreachable\")]\n",
+	})
+	service, _ := newService()
+
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStrings(t, []string{
+		"main.txt: main.txt:1:1: [Break()]",
+		"main.txt:1:1: [Break()]: Break() called outside of a loop",
+	}, failures)
+	assertInt(t, 2, len(report.Nodes))
+}
+
+func TestEvaluateSecrets(t *testing.T) {
+	t.Log("should read environment variables and secrets and redact secrets from logs, failures and the report")
+
+	os.Setenv("DATA_API_TEST_URL", "http://localhost:8080")
+	defer os.Unsetenv("DATA_API_TEST_URL")
+	service, buf := newService()
+	service.Secrets = map[string]string{"TOKEN": "9m1-secret", "PIN": "12"}
+	_, err := service.Eval(context.Background(), `[PrintF("%v %v", [Env("DATA_API_TEST_URL")], [Env("DATA_API_TEST_MISSING", "none")])]` +
+		`[Set(headers, ["Authorization: Bearer {{[Secret(\"TOKEN\")]}}"], list)][PrintF("%v", headers[0])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "http://localhost:8080 none\nAuthorization: Bearer *****\n", buf.String())
+
+	_, err = service.Eval(context.Background(), `[AssertEquals([Secret("TOKEN")], "9m1")]`)
+	assertString(t, "Expected 9m1 but got *****", err.Error())
+	if _, ok := errors.Cause(err).(*dataapi.EvalError); !ok {
+		t.Fatalf("expected the redacted error to keep its cause, got %T", errors.Cause(err))
+	}
+	_, err = service.Eval(context.Background(), `[Secret("MISSING")]`)
+	assertString(t, "secret MISSING not found", err.Error())
+	_, err = service.Eval(context.Background(), `[AssertEquals([Secret("PIN")], "1")]`)
+	assertString(t, "Expected 1 but got *****", err.Error())
+
+	writeScripts(t, map[string]string{
+		"main.txt": "[Set(token, [Secret(\"TOKEN\")], string)]\n[Fail(\"rejected {{token}}\")]\n",
+	})
+	report := service.Evaluate(context.Background(), "main.txt")["report"].(*tools.Tree)
+	failures, _, err := service.GetResults(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStrings(t, []string{
+		"main.txt: main.txt:2:1: [Fail(\"rejected {{token}}\")]",
+		"main.txt:2:1: [Fail(\"rejected {{token}}\")]: rejected *****",
+	}, failures)
+}
@@ -0,0 +1,146 @@
+package dataapi
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// divisionScale is the number of decimal places kept when a division does not terminate
+// Eg: 1.0/3 = 0.3333333333333333
+const divisionScale = 16
+
+// Decimal is an exact decimal number used for money amounts
+// Unlike float64, arithmetic and comparisons on decimals are exact, so 0.1 + 0.2 == 0.3
+// The scale is the number of decimal places the number is printed with, so 20.00 stays 20.00
+type Decimal struct {
+	rat   *big.Rat
+	scale int
+}
+
+// NewDecimal parses a decimal number
+// Eg: "20.00", "-1.5" or "2000"
+func NewDecimal(s string) (Decimal, error) {
+
+	s = strings.TrimSpace(s)
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return Decimal{}, errors.Errorf("%v is not a decimal", s)
+	}
+	scale := 0
+	if i := strings.Index(s, "."); i >= 0 {
+		scale = len(s) - i - 1
+	}
+
+	return Decimal{rat: rat, scale: scale}, nil
+
+}
+
+// DecimalFromInt converts an int to a Decimal
+func DecimalFromInt(i int) Decimal {
+	return Decimal{rat: new(big.Rat).SetInt64(int64(i))}
+}
+
+// DecimalFromFloat converts a float64 to the Decimal of its shortest printed value
+// Eg: 0.1 becomes exactly 0.1 instead of 0.1000000000000000055511151231257827
+// NaN and infinite floats are not decimals and return an error
+func DecimalFromFloat(f float64) (Decimal, error) {
+	return NewDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Add returns d + e
+func (d Decimal) Add(e Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Add(d.r(), e.r()), scale: max(d.scale, e.scale)}
+}
+
+// Sub returns d - e
+func (d Decimal) Sub(e Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Sub(d.r(), e.r()), scale: max(d.scale, e.scale)}
+}
+
+// Mul returns d * e
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Mul(d.r(), e.r()), scale: d.scale + e.scale}
+}
+
+// Quo returns d / e
+func (d Decimal) Quo(e Decimal) (Decimal, error) {
+	if e.r().Sign() == 0 {
+		return Decimal{}, errors.New("division by zero")
+	}
+	return Decimal{rat: new(big.Rat).Quo(d.r(), e.r()), scale: max(d.scale, e.scale)}, nil
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{rat: new(big.Rat).Neg(d.r()), scale: d.scale}
+}
+
+// Cmp returns -1, 0 or 1 if d is less than, equal to or greater than e
+func (d Decimal) Cmp(e Decimal) int {
+	return d.r().Cmp(e.r())
+}
+
+// Float64 returns the nearest float64 to d
+func (d Decimal) Float64() float64 {
+	f, _ := d.r().Float64()
+	return f
+}
+
+// String returns d with at least as many decimal places as its scale
+// More places are added when needed to print d exactly, up to divisionScale places
+func (d Decimal) String() string {
+
+	places := d.scale
+	if exact, ok := decimalPlaces(d.r()); !ok {
+		places = max(places, divisionScale)
+	} else if exact > places {
+		places = exact
+	}
+
+	return d.r().FloatString(places)
+
+}
+
+// MarshalJSON writes d as a JSON number so decimals can be sent in JSON bodies
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// r returns the value of d, the zero Decimal is 0
+func (d Decimal) r() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return d.rat
+}
+
+// decimalPlaces returns the number of decimal places needed to print a rational number exactly
+// It returns false if the decimal expansion of the number does not terminate
+func decimalPlaces(rat *big.Rat) (int, bool) {
+
+	denom := new(big.Int).Set(rat.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for mod.Mod(denom, two).Sign() == 0 {
+		denom.Quo(denom, two)
+		twos++
+	}
+	for mod.Mod(denom, five).Sign() == 0 {
+		denom.Quo(denom, five)
+		fives++
+	}
+
+	return max(twos, fives), denom.Cmp(big.NewInt(1)) == 0
+
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,5 +1,12 @@
 package dataapi
 
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Error implements the error interface and is used to identify a trusted error
 // The DataAPI uses a cascading error mechanism to report on multiple errors
 // Thus this struct is not used and is here just to complete the architecture
@@ -10,3 +17,143 @@ type Error struct {
 func (err *Error) Error() string {
 	return err.Err.Error()
 }
+
+// SyntaxError is returned when data code can not be parsed
+// Pos points to the token where parsing failed
+type SyntaxError struct {
+	Pos Pos
+	Msg string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Pos, err.Msg)
+}
+
+// EvalError is returned when a data function call fails
+// It records where the call is in the source so the report can point to the
+// exact call that failed, even when it is nested inside a For or If body
+type EvalError struct {
+	Pos  Pos
+	Call string
+	Err  error
+}
+
+func (err *EvalError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the error the data function call failed with
+func (err *EvalError) Unwrap() error {
+	return err.Err
+}
+
+// EvalErrors is returned when more than one call in a block failed
+type EvalErrors []error
+
+func (errs EvalErrors) Error() string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Err returns nil if there are no errors, the error itself if there is
+// only one and the whole list otherwise
+func (errs EvalErrors) Err() error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errs
+}
+
+// RowsError is returned by ForEachRow when the body failed for at least one row
+// Names holds the name of every row that ran and Errs the error of every row, nil for the rows that passed,
+// so the report shows a node for every row and one failing row does not hide the others
+type RowsError struct {
+	Names []string
+	Errs  []error
+}
+
+func (err *RowsError) Error() string {
+	var messages []string
+	for i, e := range err.Errs {
+		if e != nil {
+			messages = append(messages, fmt.Sprintf("%v: %v", err.Names[i], e))
+		}
+	}
+	return strings.Join(messages, ", ")
+}
+
+// TimeoutError is returned by code that was stopped because the evaluation was cancelled or ran out of time
+// Limit is the limit of the Timeout that ran out, or 0 if the deadline was not set with Timeout
+type TimeoutError struct {
+	Limit time.Duration
+	Err   error
+}
+
+func (err *TimeoutError) Error() string {
+	switch {
+	case err.Err == context.Canceled:
+		return "evaluation cancelled"
+	case err.Limit > 0:
+		return fmt.Sprintf("timed out after %v", err.Limit)
+	}
+	return "timed out"
+}
+
+// Unwrap returns the error of the context that was cancelled or ran out of time
+func (err *TimeoutError) Unwrap() error {
+	return err.Err
+}
+
+// RedactedError is an error whose message held the value of a secret
+// Msg is the message with the secrets redacted, while Err keeps the original error so that its type can still be checked
+type RedactedError struct {
+	Msg string
+	Err error
+}
+
+func (err *RedactedError) Error() string {
+	return err.Msg
+}
+
+// Unwrap returns the error whose message was redacted
+func (err *RedactedError) Unwrap() error {
+	return err.Err
+}
+
+// Cause returns the error whose message was redacted, for use with errors.Cause
+func (err *RedactedError) Cause() error {
+	return err.Err
+}
+
+// SignalKind identifies which control flow data function raised a Signal
+type SignalKind int
+
+const (
+	SignalBreak SignalKind = iota
+	SignalContinue
+	SignalReturn
+)
+
+// Signal is returned by Break, Continue and Return to stop evaluating the current
+// block and unwind to the loop, function or file that handles it
+// A Signal is only an error when nothing handles it, Eg: a Break outside of a loop
+type Signal struct {
+	Kind  SignalKind
+	Value interface{}
+}
+
+func (s *Signal) Error() string {
+	switch s.Kind {
+	case SignalBreak:
+		return "Break() called outside of a loop"
+	case SignalContinue:
+		return "Continue() called outside of a loop"
+	}
+	return "Return() called outside of a function or file"
+}
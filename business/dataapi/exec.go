@@ -0,0 +1,634 @@
+package dataapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// call runs the data function with the name of the call
+// Data functions are looked up on the registry of the service first and then
+// on the data functions defined in data code with Func and lastly on the core
+// A data function fails when it returns a non nil error
+func (d DataAPIService) call(c *Call) (interface{}, error) {
+
+	// Find the registered data function
+	// Fall back to the data functions defined in data code with Func and then to the functions of core
+	parameters, named, err := splitNamed(c.Args)
+	if err != nil {
+		return nil, err
+	}
+	function, ok := d.registry().Lookup(c.Name)
+	if !ok {
+		val, _ := d.scope().Get(c.Name)
+		userFunction, isFunction := val.(*Function)
+		switch {
+		case !isFunction && !d.hasCoreFunction(c.Name):
+			return nil, errors.Errorf("data function %v not found", c.Name)
+		case len(named) > 0:
+			return nil, errors.Errorf("%v does not accept named parameters", c.Name)
+		case isFunction:
+			return d.callFunction(userFunction, c.Args)
+		}
+		return d.callCore(c.Name, c.Args)
+	}
+	if len(named) > 0 && !function.Signature.Named {
+		return nil, errors.Errorf("%v does not accept named parameters", c.Name)
+	}
+
+	// Ensure the number of parameters matches the signature of the data function
+	// Then evaluate the parameters as declared by the signature
+	if arity := function.Signature.arity(); !arity.accepts(len(parameters)) {
+		return nil, errors.Errorf("%v expected %v parameters but got: %v", c.Name, arity, len(parameters))
+	}
+	args, err := d.evalArgs(function.Signature, parameters)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range named {
+		args = append(args, arg)
+	}
+
+	return function.Func(d, args)
+
+}
+
+// callFunction runs a data function that was defined in data code with Func
+// The parameters are evaluated in the scope of the caller and bound in a new
+// scope that is layered over the scope the function was defined in
+func (d DataAPIService) callFunction(function *Function, args []Node) (interface{}, error) {
+
+	if len(args) != len(function.Params) {
+		return nil, errors.Errorf("%v expected %v parameters but got: %v", function.Name, len(function.Params), len(args))
+	}
+	scope := NewScope(function.Scope)
+	for i, arg := range args {
+		val, err := d.EvalNode(arg)
+		if err != nil {
+			return nil, err
+		}
+		scope.Define(function.Params[i], val)
+	}
+
+	// Run the body and return the result in the scope of the function
+	// Return stops the body early with the value it was given
+	local := d
+	local.Scope = scope
+	if _, err := local.EvalNode(function.Body); err != nil {
+		signal, ok := err.(*Signal)
+		if ok && signal.Kind == SignalReturn {
+			return signal.Value, nil
+		}
+		return nil, err
+	}
+	if function.Result == nil {
+		return nil, nil
+	}
+
+	return local.EvalNode(function.Result)
+
+}
+
+// loop runs the body in a new block scope for as long as the condition is true
+// Break stops the loop, Continue moves on to the next iteration and
+// Return is passed on to the function or file the loop is in
+// The loop fails once it has run the maximum number of iterations, the name of the loop is used in the error
+func (d DataAPIService) loop(name string, condition Node, body Node) error {
+
+	for i := 0; ; i++ {
+		// Run the condition to see if it returns true or false
+		boolean, err := d.EvalBool(condition)
+		if err != nil {
+			return err
+		}
+		if !boolean {
+			return nil
+		}
+		if max := d.Limits.maxIterations(); i >= max {
+			return errors.Errorf("%v loop stopped after reaching the limit of %v iterations", name, max)
+		}
+
+		// Every iteration runs in a new block scope
+		local := d
+		local.Scope = NewBlockScope(d.scope())
+		_, err = local.EvalNode(body)
+		if stop, err := iteration(err); stop {
+			return err
+		}
+	}
+
+}
+
+// each runs the body in a new block scope once for every item
+// The item, and the index of the item if an index variable is given,
+// are defined on the block scope of the iteration
+func (d DataAPIService) each(index string, item string, items []interface{}, body Node) error {
+
+	for i, val := range items {
+		local := d
+		local.Scope = NewBlockScope(d.scope())
+		if index != "" {
+			local.Scope.Define(index, i)
+		}
+		local.Scope.Define(item, val)
+		_, err := local.EvalNode(body)
+		if stop, err := iteration(err); stop {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// eachRow runs the body once for every row with the columns of the row defined as variables
+// The whole row is defined as the variable row after the columns, so columns that are not identifiers
+// can be read with row["Store ID"] and a column named row can be read with row["row"]
+// Every row runs in a new block scope and a row that fails does not stop the rows after it
+// Rows are named after the value of the name column, or their number if no name column is given
+func (d DataAPIService) eachRow(rows []map[string]interface{}, name string, body Node) (Rows, error) {
+
+	failed := false
+	rowsErr := &RowsError{}
+	for i, row := range rows {
+		rowName := fmt.Sprintf("row %v", i+1)
+		if name != "" {
+			val, ok := row[name]
+			if !ok {
+				return nil, errors.Errorf("row %v has no column %v", i+1, name)
+			}
+			rowName = fmt.Sprintf("%v=%v", name, val)
+		}
+		local := d
+		local.Scope = NewBlockScope(d.scope())
+		for column, val := range row {
+			local.Scope.Define(column, val)
+		}
+		local.Scope.Define("row", row)
+		_, err := local.EvalNode(body)
+		if signal, ok := err.(*Signal); ok && signal.Kind == SignalReturn {
+			return nil, err
+		}
+		stop, err := iteration(err)
+		rowsErr.Names = append(rowsErr.Names, rowName)
+		rowsErr.Errs = append(rowsErr.Errs, err)
+		failed = failed || err != nil
+		if stop && err == nil {
+			break
+		}
+	}
+	if failed {
+		return nil, rowsErr
+	}
+
+	return rowsErr.Names, nil
+
+}
+
+// iteration interprets the error returned from the body of a loop
+// It returns true if the loop must stop, along with the error the loop must return
+// Break stops the loop without an error and Continue moves on to the next iteration
+func iteration(err error) (bool, error) {
+	if signal, ok := err.(*Signal); ok {
+		switch signal.Kind {
+		case SignalBreak:
+			return true, nil
+		case SignalContinue:
+			return false, nil
+		}
+	}
+	return err != nil, err
+}
+
+// branch runs the code of the branch an If, IfElse or Switch took
+// Failures are wrapped in an EvalError named after the branch, so the report
+// shows which branch of the statement the failures happened in
+func (d DataAPIService) branch(name string, body Node) error {
+
+	_, err := d.EvalNode(body)
+	if _, ok := err.(*Signal); ok || err == nil {
+		return err
+	}
+
+	return &EvalError{Pos: body.Pos(), Call: name + ": " + body.String(), Err: err}
+
+}
+
+// isDataFunction returns true if the name is a registered data function
+func (d DataAPIService) isDataFunction(name string) bool {
+	_, ok := d.registry().Lookup(name)
+	return ok
+}
+
+// step counts an evaluated expression against the limit of the run
+// It fails once the evaluation was cancelled or timed out
+func (d DataAPIService) step() error {
+	if err := d.done(); err != nil {
+		return err
+	}
+	if d.Run == nil {
+		return nil
+	}
+	max := d.Limits.maxSteps()
+	if atomic.AddInt64(&d.Run.steps, 1) > int64(max) {
+		return errors.Errorf("run stopped after reaching the limit of %v evaluated expressions", max)
+	}
+	return nil
+}
+
+// exhausted returns true if the run has reached its limit of evaluated expressions
+func (d DataAPIService) exhausted() bool {
+	return d.Run != nil && atomic.LoadInt64(&d.Run.steps) > int64(d.Limits.maxSteps())
+}
+
+// withContext returns the service evaluating code under the given context
+func (d DataAPIService) withContext(ctx context.Context) DataAPIService {
+	d.ctx = ctx
+	return d
+}
+
+// withTimeout returns the service evaluating code that must finish within the given limit
+// A sooner deadline of the code the service is already evaluating stays in place
+func (d DataAPIService) withTimeout(limit time.Duration) (DataAPIService, context.CancelFunc) {
+	parent := d.context()
+	if deadline, ok := parent.Deadline(); !ok || time.Now().Add(limit).Before(deadline) {
+		d.timeout = limit
+	}
+	ctx, cancel := context.WithTimeout(parent, limit)
+	d.ctx = ctx
+	return d, cancel
+}
+
+// context returns the context of the code being evaluated
+func (d DataAPIService) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// done returns a TimeoutError once the code being evaluated was cancelled or ran out of time
+func (d DataAPIService) done() error {
+	err := d.context().Err()
+	if err == nil {
+		return nil
+	}
+	return &TimeoutError{Limit: d.timeout, Err: err}
+}
+
+// evalSeconds evaluates a number of seconds, which may have a fraction, to a duration
+func (d DataAPIService) evalSeconds(expression Node) (time.Duration, error) {
+	val, err := d.EvalNode(expression)
+	if err != nil {
+		return 0, err
+	}
+	seconds, ok := toFloat(val)
+	if !ok || seconds <= 0 {
+		return 0, errors.Errorf("%v is not a positive number of seconds", val)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// withRun returns the service with the state for a new run if no run has been started
+// The logger of a new run redacts the secrets of the run
+func (d DataAPIService) withRun() DataAPIService {
+	if d.Run == nil {
+		d.Run = NewRun(d.Seed)
+		if d.Log != nil {
+			d.Log = redactLogger{log: d.Log, run: d.Run}
+		}
+	}
+	return d
+}
+
+// scope returns the innermost scope that is being evaluated
+// When no scope has been entered the global EvalCache is the scope
+func (d DataAPIService) scope() *Scope {
+	if d.Scope == nil {
+		return &Scope{Vars: d.EvalCache}
+	}
+	return d.Scope
+}
+
+// evalBlock runs every call in the block
+// A failing call does not stop the block, all errors are joined together
+// The value of the block is the value of the last call
+func (d DataAPIService) evalBlock(block *Block) (interface{}, error) {
+
+	var val interface{}
+	var allErrors EvalErrors
+	for _, c := range block.Calls {
+		v, err := d.EvalNode(c)
+		if _, ok := err.(*Signal); ok {
+			// Control flow stops the block, unless the block already failed
+			if allErrors.Err() != nil {
+				return nil, allErrors.Err()
+			}
+			return nil, err
+		}
+		if err != nil {
+			allErrors = append(allErrors, err)
+			continue
+		}
+		val = v
+	}
+	if err := allErrors.Err(); err != nil {
+		return nil, err
+	}
+
+	return val, nil
+
+}
+
+// evalTemplate evaluates the placeholders of a template in the current scope and joins all the parts
+// Lists and maps are written as JSON so they can be placed in JSON bodies
+func (d DataAPIService) evalTemplate(template *Template) (interface{}, error) {
+
+	var out strings.Builder
+	for _, part := range template.Parts {
+		val, err := d.EvalNode(part)
+		if err != nil {
+			return nil, err
+		}
+		switch val.(type) {
+		case nil:
+			return nil, errors.Errorf("{{%v}} did not evaluate to a value", part)
+		case []interface{}, []string, []int, map[string]interface{}:
+			b, err := json.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		default:
+			fmt.Fprintf(&out, "%v", val)
+		}
+	}
+
+	return out.String(), nil
+
+}
+
+// evalItems evaluates the items of a list or tuple into a list
+func (d DataAPIService) evalItems(items []Node) ([]interface{}, error) {
+	out := []interface{}{}
+	for _, item := range items {
+		val, err := d.EvalNode(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, val)
+	}
+	return out, nil
+}
+
+// evalUnary applies '!' or '-' to the operand
+func (d DataAPIService) evalUnary(expression *UnaryExpr) (interface{}, error) {
+
+	x, err := d.EvalNode(expression.X)
+	if err != nil {
+		return nil, err
+	}
+
+	switch expression.Op {
+	case "!":
+		boolean, ok := toBool(x)
+		if !ok {
+			return nil, errors.Errorf("operator ! not defined on %v", x)
+		}
+		return !boolean, nil
+	case "-":
+		switch x := x.(type) {
+		case int:
+			return -x, nil
+		case float64:
+			return -x, nil
+		case Decimal:
+			return x.Neg(), nil
+		}
+		return nil, errors.Errorf("operator - not defined on %v", x)
+	}
+
+	return nil, errors.Errorf("unknown operator %v", expression.Op)
+
+}
+
+// evalBinary applies a binary operator to both operands
+// The '&&' and '||' operators short circuit and do not evaluate the right operand if not needed
+func (d DataAPIService) evalBinary(expression *BinaryExpr) (interface{}, error) {
+
+	x, err := d.EvalNode(expression.X)
+	if err != nil {
+		return nil, err
+	}
+
+	if expression.Op == "&&" || expression.Op == "||" {
+		left, ok := toBool(x)
+		if !ok {
+			return nil, errors.Errorf("operator %v not defined on %v", expression.Op, x)
+		}
+		if (expression.Op == "&&" && !left) || (expression.Op == "||" && left) {
+			return left, nil
+		}
+		y, err := d.EvalNode(expression.Y)
+		if err != nil {
+			return nil, err
+		}
+		right, ok := toBool(y)
+		if !ok {
+			return nil, errors.Errorf("operator %v not defined on %v", expression.Op, y)
+		}
+		return right, nil
+	}
+
+	y, err := d.EvalNode(expression.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	return binaryOp(expression.Op, x, y)
+
+}
+
+// binaryOp applies an arithmetic, comparison or concatenation operator to two values
+func binaryOp(op string, x interface{}, y interface{}) (interface{}, error) {
+
+	// Times and durations have their own arithmetic and comparisons
+	if val, ok, err := timeOp(op, x, y); ok {
+		return val, err
+	}
+
+	// Integer arithmetic stays integer, any decimal operand promotes both to an exact decimal
+	// and otherwise any float operand promotes both to float
+	xInt, xIsInt := x.(int)
+	yInt, yIsInt := y.(int)
+	if xIsInt && yIsInt {
+		switch op {
+		case "+":
+			return xInt + yInt, nil
+		case "-":
+			return xInt - yInt, nil
+		case "*":
+			return xInt * yInt, nil
+		case "/", "%":
+			if yInt == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "/" {
+				return xInt / yInt, nil
+			}
+			return xInt % yInt, nil
+		}
+	}
+	_, xIsDecimal := x.(Decimal)
+	_, yIsDecimal := y.(Decimal)
+	xDecimal, xIsNumber, xErr := toDecimal(x)
+	yDecimal, yIsNumber, yErr := toDecimal(y)
+	if (xIsDecimal || yIsDecimal) && xIsNumber && yIsNumber {
+		if xErr != nil {
+			return nil, xErr
+		}
+		if yErr != nil {
+			return nil, yErr
+		}
+		switch op {
+		case "+":
+			return xDecimal.Add(yDecimal), nil
+		case "-":
+			return xDecimal.Sub(yDecimal), nil
+		case "*":
+			return xDecimal.Mul(yDecimal), nil
+		case "/":
+			return xDecimal.Quo(yDecimal)
+		case "==":
+			return xDecimal.Cmp(yDecimal) == 0, nil
+		case "!=":
+			return xDecimal.Cmp(yDecimal) != 0, nil
+		case "<":
+			return xDecimal.Cmp(yDecimal) < 0, nil
+		case "<=":
+			return xDecimal.Cmp(yDecimal) <= 0, nil
+		case ">":
+			return xDecimal.Cmp(yDecimal) > 0, nil
+		case ">=":
+			return xDecimal.Cmp(yDecimal) >= 0, nil
+		}
+		return nil, errors.Errorf("operator %v not defined on %v and %v", op, x, y)
+	}
+	xFloat, xIsNumber := toFloat(x)
+	yFloat, yIsNumber := toFloat(y)
+	if xIsNumber && yIsNumber {
+		switch op {
+		case "+":
+			return xFloat + yFloat, nil
+		case "-":
+			return xFloat - yFloat, nil
+		case "*":
+			return xFloat * yFloat, nil
+		case "/":
+			if yFloat == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return xFloat / yFloat, nil
+		case "==":
+			return xFloat == yFloat, nil
+		case "!=":
+			return xFloat != yFloat, nil
+		case "<":
+			return xFloat < yFloat, nil
+		case "<=":
+			return xFloat <= yFloat, nil
+		case ">":
+			return xFloat > yFloat, nil
+		case ">=":
+			return xFloat >= yFloat, nil
+		}
+		return nil, errors.Errorf("operator %v not defined on %v and %v", op, x, y)
+	}
+
+	// Strings concatenate and compare lexically
+	// A string compared to any other type is compared to its printed value
+	_, xIsString := x.(string)
+	_, yIsString := y.(string)
+	if xIsString || yIsString {
+		xString := fmt.Sprintf("%v", x)
+		yString := fmt.Sprintf("%v", y)
+		switch op {
+		case "+":
+			return xString + yString, nil
+		case "==":
+			return xString == yString, nil
+		case "!=":
+			return xString != yString, nil
+		case "<":
+			return xString < yString, nil
+		case "<=":
+			return xString <= yString, nil
+		case ">":
+			return xString > yString, nil
+		case ">=":
+			return xString >= yString, nil
+		}
+		return nil, errors.Errorf("operator %v not defined on %v and %v", op, x, y)
+	}
+
+	switch op {
+	case "==":
+		return reflect.DeepEqual(x, y), nil
+	case "!=":
+		return !reflect.DeepEqual(x, y), nil
+	}
+
+	return nil, errors.Errorf("operator %v not defined on %v and %v", op, x, y)
+
+}
+
+// toBool converts booleans and the strings "true" and "false" to a bool
+func toBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		boolean, err := strconv.ParseBool(v)
+		return boolean, err == nil
+	}
+	return false, false
+}
+
+// toFloat converts any numeric value to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case Decimal:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+// toDecimal converts ints, floats and decimals to an exact Decimal
+// ok is false when the value is not a number, and an error is returned for a NaN or infinite float
+func toDecimal(v interface{}) (Decimal, bool, error) {
+	switch v := v.(type) {
+	case int:
+		return DecimalFromInt(v), true, nil
+	case int64:
+		return DecimalFromInt(int(v)), true, nil
+	case float64:
+		d, err := DecimalFromFloat(v)
+		return d, true, err
+	case Decimal:
+		return v, true, nil
+	}
+	return Decimal{}, false, nil
+}
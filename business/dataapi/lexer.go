@@ -0,0 +1,337 @@
+package dataapi
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind identifies the type of token produced by the Lexer
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenIllegal
+	TokenIdent
+	TokenInt
+	TokenFloat
+	TokenString
+	TokenOperator
+	TokenLBracket
+	TokenRBracket
+	TokenLParen
+	TokenRParen
+	TokenComma
+	TokenDot
+	TokenAssign
+)
+
+// String returns a human readable name for the token kind
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "end of input"
+	case TokenIllegal:
+		return "illegal token"
+	case TokenIdent:
+		return "identifier"
+	case TokenInt:
+		return "int"
+	case TokenFloat:
+		return "float"
+	case TokenString:
+		return "string"
+	case TokenOperator:
+		return "operator"
+	case TokenLBracket:
+		return "'['"
+	case TokenRBracket:
+		return "']'"
+	case TokenLParen:
+		return "'('"
+	case TokenRParen:
+		return "')'"
+	case TokenComma:
+		return "','"
+	case TokenDot:
+		return "'.'"
+	case TokenAssign:
+		return "'='"
+	}
+	return "unknown token"
+}
+
+// Pos is a position within a data code source file
+// Line and Col are 1 based, Offset is the 0 based byte offset into the source
+type Pos struct {
+	File   string
+	Line   int
+	Col    int
+	Offset int
+}
+
+// String returns the position in the format file:line:col
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%v:%v", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%v:%v:%v", p.File, p.Line, p.Col)
+}
+
+// Token is a single lexical element of data code
+// Text is the raw source of the token while Value holds the unescaped
+// contents for string literals and the error message for illegal tokens
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Value string
+	Pos   Pos
+}
+
+// Lexer splits data code into tokens
+// Strings are lexed as a single token so that brackets, commas and
+// parenthesis inside a string literal never affect the structure of the code
+type Lexer struct {
+	file   string
+	src    string
+	offset int
+	line   int
+	col    int
+}
+
+// NewLexer creates a Lexer over the given source
+// The file name is only used to annotate token positions
+func NewLexer(file string, src string) *Lexer {
+	return &Lexer{file: file, src: src, line: 1, col: 1}
+}
+
+// Lex returns all the tokens in the given source, terminated by a TokenEOF
+func Lex(file string, src string) []Token {
+	return NewLexer(file, src).all()
+}
+
+// all returns all the remaining tokens, terminated by a TokenEOF
+func (l *Lexer) all() []Token {
+	var tokens []Token
+	for {
+		token := l.Next()
+		tokens = append(tokens, token)
+		if token.Kind == TokenEOF {
+			return tokens
+		}
+	}
+}
+
+// Next returns the next token in the source
+// Whitespace and '#' comments that run until the end of the line are skipped
+func (l *Lexer) Next() Token {
+
+	l.skipWhitespaceAndComments()
+	start := l.pos()
+	if l.offset >= len(l.src) {
+		return Token{Kind: TokenEOF, Pos: start}
+	}
+
+	r := l.peek()
+	switch {
+	case r == '"':
+		return l.lexString(start)
+	case isDigit(r):
+		return l.lexNumber(start)
+	case isIdentStart(r):
+		for l.offset < len(l.src) && isIdentPart(l.peek()) {
+			l.advance()
+		}
+		return l.token(TokenIdent, start)
+	}
+
+	l.advance()
+	switch r {
+	case '[':
+		return l.token(TokenLBracket, start)
+	case ']':
+		return l.token(TokenRBracket, start)
+	case '(':
+		return l.token(TokenLParen, start)
+	case ')':
+		return l.token(TokenRParen, start)
+	case ',':
+		return l.token(TokenComma, start)
+	case '.':
+		return l.token(TokenDot, start)
+	case '+', '-', '*', '/', '%':
+		return l.token(TokenOperator, start)
+	case '<', '>', '!':
+		if l.offset < len(l.src) && l.peek() == '=' {
+			l.advance()
+		}
+		return l.token(TokenOperator, start)
+	case '=':
+		if l.offset < len(l.src) && l.peek() == '=' {
+			l.advance()
+			return l.token(TokenOperator, start)
+		}
+		return l.token(TokenAssign, start)
+	case '&', '|':
+		if l.offset < len(l.src) && l.peek() == r {
+			l.advance()
+			return l.token(TokenOperator, start)
+		}
+	}
+
+	token := l.token(TokenIllegal, start)
+	token.Value = fmt.Sprintf("unexpected character %q", r)
+	return token
+
+}
+
+// lexString reads a double quoted string literal and resolves its escape sequences
+// Unknown escape sequences are kept as is, so "\d" stays a backslash followed by d
+// The escape sequences \{ and \} write a brace, so "\{{name}}" is not a template placeholder
+// A string literal may not span multiple lines
+func (l *Lexer) lexString(start Pos) Token {
+
+	var value strings.Builder
+	l.advance()
+	for l.offset < len(l.src) {
+		r := l.peek()
+		switch r {
+		case '"':
+			l.advance()
+			token := l.token(TokenString, start)
+			token.Value = value.String()
+			return token
+		case '\n':
+			token := l.token(TokenIllegal, start)
+			token.Value = "unterminated string literal"
+			return token
+		case '\\':
+			l.advance()
+			if l.offset >= len(l.src) {
+				break
+			}
+			escaped := l.peek()
+			if escaped == '\n' {
+				token := l.token(TokenIllegal, start)
+				token.Value = "unterminated string literal"
+				return token
+			}
+			value.WriteString(unescape(escaped))
+			l.advance()
+		default:
+			value.WriteRune(r)
+			l.advance()
+		}
+	}
+
+	token := l.token(TokenIllegal, start)
+	token.Value = "unterminated string literal"
+	return token
+
+}
+
+// unescape returns the text an escape sequence in a string literal stands for
+// The rune is the character following the backslash
+func unescape(r rune) string {
+	switch r {
+	case '"', '\\', '{', '}':
+		return string(r)
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	}
+	return "\\" + string(r)
+}
+
+// unquote resolves the escape sequences in the raw text of a string literal
+func unquote(raw string) string {
+	var value strings.Builder
+	for i := 0; i < len(raw); {
+		if raw[i] == '\\' && i+1 < len(raw) {
+			r, size := utf8.DecodeRuneInString(raw[i+1:])
+			value.WriteString(unescape(r))
+			i += 1 + size
+			continue
+		}
+		value.WriteByte(raw[i])
+		i++
+	}
+	return value.String()
+}
+
+// lexNumber reads an int or float literal
+func (l *Lexer) lexNumber(start Pos) Token {
+	for l.offset < len(l.src) && isDigit(l.peek()) {
+		l.advance()
+	}
+	if l.offset+1 < len(l.src) && l.src[l.offset] == '.' && isDigit(rune(l.src[l.offset+1])) {
+		l.advance()
+		for l.offset < len(l.src) && isDigit(l.peek()) {
+			l.advance()
+		}
+		return l.token(TokenFloat, start)
+	}
+	return l.token(TokenInt, start)
+}
+
+// skipWhitespaceAndComments moves the lexer past any whitespace and comments
+func (l *Lexer) skipWhitespaceAndComments() {
+	for l.offset < len(l.src) {
+		r := l.peek()
+		if r == '#' {
+			for l.offset < len(l.src) && l.peek() != '\n' {
+				l.advance()
+			}
+			continue
+		}
+		if !unicode.IsSpace(r) {
+			return
+		}
+		l.advance()
+	}
+}
+
+// token creates a token of the given kind spanning from start to the current offset
+func (l *Lexer) token(kind TokenKind, start Pos) Token {
+	text := l.src[start.Offset:l.offset]
+	return Token{Kind: kind, Text: text, Value: text, Pos: start}
+}
+
+// pos returns the current position of the lexer
+func (l *Lexer) pos() Pos {
+	return Pos{File: l.file, Line: l.line, Col: l.col, Offset: l.offset}
+}
+
+// peek returns the rune at the current offset without consuming it
+func (l *Lexer) peek() rune {
+	r, _ := utf8.DecodeRuneInString(l.src[l.offset:])
+	return r
+}
+
+// advance consumes the rune at the current offset
+func (l *Lexer) advance() {
+	r, size := utf8.DecodeRuneInString(l.src[l.offset:])
+	l.offset += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+		return
+	}
+	l.col++
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
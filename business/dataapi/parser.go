@@ -0,0 +1,553 @@
+package dataapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// precedence holds the binding power of every binary operator
+// Operators with a higher precedence bind tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  3,
+	"<=": 3,
+	">":  3,
+	">=": 3,
+	"+":  4,
+	"-":  4,
+	"*":  5,
+	"/":  5,
+	"%":  5,
+}
+
+// Parser builds an AST out of the tokens produced by the Lexer
+// Grammar:
+// > script     = { expression }
+// > argument   = call { call } | expression
+// > expression = unary { operator unary }
+// > unary      = [ "!" | "-" ] postfix
+// > postfix    = primary { index | selector }
+// > index      = "[" expression "]", written directly after the indexed expression
+// > selector   = "." identifier
+// > primary    = int | float | string | template | identifier | type | tuple | list | call
+// > template   = a string containing "{{" expression "}}" placeholders, Eg: "Hello {{name}}"
+// > type       = "[" "]" identifier
+// > tuple      = "(" [ argument { "," argument } ] ")"
+// > list       = "[" [ argument { "," argument } ] "]"
+// > call       = "[" identifier "(" [ parameter { "," parameter } ] ")" "]"
+// > parameter  = [ identifier "=" ] argument
+type Parser struct {
+	src    string
+	tokens []Token
+	index  int
+}
+
+// NewParser creates a Parser over the given source
+func NewParser(file string, src string) *Parser {
+	return &Parser{src: src, tokens: Lex(file, src)}
+}
+
+// ParseScript parses an entire data code file
+// A statement that can not be parsed is stored as a BadNode and the parser
+// resumes at the next line that starts with '[', so one broken line does not
+// prevent the rest of the file from running
+func ParseScript(file string, src string) *Script {
+
+	p := NewParser(file, src)
+	script := &Script{File: file}
+	for p.peek().Kind != TokenEOF {
+		start := p.index
+		statement, err := p.parseExpression()
+		if err != nil {
+			p.synchronize(start)
+			statement = &BadNode{node: p.node(p.tokens[start].Pos), Err: err}
+		}
+		script.Statements = append(script.Statements, statement)
+	}
+
+	return script
+
+}
+
+// ParseExpression parses a single argument of data code
+// Eg: [If(i < 3, [PrintF("%v", i)])] or i%2 == 0
+func ParseExpression(file string, src string) (Node, error) {
+
+	return NewParser(file, src).parseAll()
+
+}
+
+// parseAll parses a single argument that must make up all of the source
+func (p *Parser) parseAll() (Node, error) {
+
+	expression, err := p.parseArgument()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.Kind != TokenEOF {
+		return nil, p.errorf(token, "unexpected %v after expression", describe(token))
+	}
+
+	return expression, nil
+
+}
+
+// parseArgument parses an expression, or a block when several calls are written next to each other
+func (p *Parser) parseArgument() (Node, error) {
+
+	start := p.peek().Pos
+	expression, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := expression.(*Call); !ok || p.peek().Kind != TokenLBracket {
+		return expression, nil
+	}
+
+	calls := []Node{expression}
+	for p.peek().Kind == TokenLBracket {
+		call, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+
+	return &Block{node: p.node(start), Calls: calls}, nil
+
+}
+
+// parseExpression parses a binary expression
+func (p *Parser) parseExpression() (Node, error) {
+	return p.parseBinary(1)
+}
+
+// parseBinary uses precedence climbing to parse operators of at least the given precedence
+func (p *Parser) parseBinary(minPrecedence int) (Node, error) {
+
+	start := p.peek().Pos
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := p.peek()
+		prec, ok := precedence[token.Text]
+		if token.Kind != TokenOperator || !ok || prec < minPrecedence {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{node: p.node(start), Op: token.Text, X: x, Y: y}
+	}
+
+}
+
+// parseUnary parses a postfix expression optionally prefixed with '!' or '-'
+func (p *Parser) parseUnary() (Node, error) {
+
+	token := p.peek()
+	if token.Kind == TokenOperator && (token.Text == "!" || token.Text == "-") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{node: p.node(token.Pos), Op: token.Text, X: x}, nil
+	}
+
+	return p.parsePostfix()
+
+}
+
+// parsePostfix parses a primary expression followed by any number of indexes and selectors
+// Eg: res.Failures[0] or res["Error"]
+// An index must be written directly after the expression, Eg: vouchers[0] or [Res("res")][0]
+// so that calls written next to each other are still parsed as a block
+func (p *Parser) parsePostfix() (Node, error) {
+
+	start := p.peek().Pos
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.peek().Kind == TokenDot:
+			p.next()
+			name, err := p.expect(TokenIdent)
+			if err != nil {
+				return nil, err
+			}
+			x = &Selector{node: p.node(start), X: x, Name: name.Text}
+		case p.peek().Kind == TokenLBracket && p.adjacent() && !p.isCall():
+			p.next()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(TokenRBracket); err != nil {
+				return nil, err
+			}
+			x = &Index{node: p.node(start), X: x, Index: index}
+		default:
+			return x, nil
+		}
+	}
+
+}
+
+// parsePrimary parses literals, identifiers, parenthesised expressions and calls
+func (p *Parser) parsePrimary() (Node, error) {
+
+	token := p.peek()
+	switch token.Kind {
+	case TokenInt:
+		p.next()
+		value, err := strconv.Atoi(token.Text)
+		if err != nil {
+			return nil, p.errorf(token, "invalid int %v", token.Text)
+		}
+		return &BasicLit{node: p.node(token.Pos), Kind: token.Kind, Value: value}, nil
+	case TokenFloat:
+		// Number literals with a decimal point are exact decimals so money amounts never lose precision
+		p.next()
+		value, err := NewDecimal(token.Text)
+		if err != nil {
+			return nil, p.errorf(token, "invalid decimal %v", token.Text)
+		}
+		return &BasicLit{node: p.node(token.Pos), Kind: token.Kind, Value: value}, nil
+	case TokenString:
+		p.next()
+		if strings.Contains(token.Text, "{{") {
+			return p.parseTemplate(token)
+		}
+		return &BasicLit{node: p.node(token.Pos), Kind: token.Kind, Value: token.Value}, nil
+	case TokenIdent:
+		p.next()
+		if token.Text == "true" || token.Text == "false" {
+			return &BasicLit{node: p.node(token.Pos), Kind: token.Kind, Value: token.Text == "true"}, nil
+		}
+		return &Ident{node: p.node(token.Pos), Name: token.Text}, nil
+	case TokenLParen:
+		return p.parseTuple()
+	case TokenLBracket:
+		if p.isCall() {
+			return p.parseCall()
+		}
+		if p.peekAt(1).Kind == TokenRBracket && p.peekAt(2).Kind == TokenIdent {
+			// A type such as []string
+			p.next()
+			p.next()
+			name := p.next()
+			return &Ident{node: p.node(token.Pos), Name: "[]" + name.Text}, nil
+		}
+		return p.parseList()
+	case TokenIllegal:
+		return nil, p.errorf(token, "%v", token.Value)
+	}
+
+	return nil, p.errorf(token, "unexpected %v", describe(token))
+
+}
+
+// parseTuple parses a parenthesised expression or list of expressions
+// A single expression in parenthesis is returned as is, Eg: (i < 3)
+// Anything else is returned as a Tuple, Eg: (voucher, amount) or ()
+func (p *Parser) parseTuple() (n Node, err error) {
+
+	start, err := p.expect(TokenLParen)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Node
+	defer p.unclosed(start, &err)
+	if p.peek().Kind != TokenRParen {
+		for {
+			item, err := p.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.peek().Kind != TokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(TokenRParen); err != nil {
+		return nil, err
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+
+	return &Tuple{node: p.node(start.Pos), Items: items}, nil
+
+}
+
+// parseTemplate splits a string literal into its text and the expressions of its {{...}} placeholders
+// Eg: "Hello {{name}}, your reference is {{res.Reference}}"
+// Quotes inside a placeholder are escaped like anywhere else in the string, Eg: "{{res[\"Error\"]}}"
+// A placeholder is escaped with \{{, so "\{{name}}" is the text {{name}}
+func (p *Parser) parseTemplate(token Token) (Node, error) {
+
+	raw := token.Text[1 : len(token.Text)-1]
+	var parts []Node
+	var text strings.Builder
+	placeholders := false
+	for i := 0; i < len(raw); {
+		switch {
+		case raw[i] == '\\' && i+1 < len(raw):
+			r, size := utf8.DecodeRuneInString(raw[i+1:])
+			text.WriteString(unescape(r))
+			i += 1 + size
+		case strings.HasPrefix(raw[i:], "{{"):
+			end := strings.Index(raw[i+2:], "}}")
+			if end < 0 {
+				return nil, p.errorf(token, "unterminated {{ in string literal")
+			}
+			if text.Len() > 0 {
+				parts = append(parts, &BasicLit{node: node{pos: token.Pos, raw: text.String()}, Kind: TokenString, Value: text.String()})
+				text.Reset()
+			}
+
+			// The placeholder is parsed on its own, positioned where it starts in the string
+			pos := token.Pos
+			pos.Col += 1 + utf8.RuneCountInString(raw[:i+2])
+			src := unquote(raw[i+2 : i+2+end])
+			lexer := &Lexer{file: pos.File, src: src, line: pos.Line, col: pos.Col}
+			placeholder := &Parser{src: src, tokens: lexer.all()}
+			expression, err := placeholder.parseAll()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, expression)
+			placeholders = true
+			i += 2 + end + 2
+		default:
+			text.WriteByte(raw[i])
+			i++
+		}
+	}
+	if text.Len() > 0 {
+		parts = append(parts, &BasicLit{node: node{pos: token.Pos, raw: text.String()}, Kind: TokenString, Value: text.String()})
+	}
+
+	// A string where every placeholder was escaped is just a string
+	if !placeholders {
+		return &BasicLit{node: p.node(token.Pos), Kind: token.Kind, Value: token.Value}, nil
+	}
+
+	return &Template{node: p.node(token.Pos), Parts: parts}, nil
+
+}
+
+// parseList parses a list literal
+// Eg: [1, 2, 3] or ["a", "b"] or []
+func (p *Parser) parseList() (n Node, err error) {
+
+	start, err := p.expect(TokenLBracket)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Node
+	defer p.unclosed(start, &err)
+	if p.peek().Kind != TokenRBracket {
+		for {
+			item, err := p.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.peek().Kind != TokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(TokenRBracket); err != nil {
+		return nil, err
+	}
+
+	return &List{node: p.node(start.Pos), Items: items}, nil
+
+}
+
+// parseCall parses a data function call
+// Eg: [PrintF("Hello World %v", i)]
+func (p *Parser) parseCall() (n Node, err error) {
+
+	start, err := p.expect(TokenLBracket)
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.expect(TokenIdent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokenLParen); err != nil {
+		return nil, err
+	}
+
+	var args []Node
+	defer p.unclosed(start, &err)
+	if p.peek().Kind != TokenRParen {
+		for {
+			arg, err := p.parseParameter()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().Kind != TokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(TokenRParen); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokenRBracket); err != nil {
+		return nil, err
+	}
+
+	return &Call{node: p.node(start.Pos), Name: name.Text, Args: args}, nil
+
+}
+
+// parseParameter parses a parameter of a call, which is either an argument or a named argument
+// Eg: "Store1" or storeID="Store1"
+func (p *Parser) parseParameter() (Node, error) {
+
+	if p.peek().Kind != TokenIdent || p.peekAt(1).Kind != TokenAssign {
+		return p.parseArgument()
+	}
+	name := p.next()
+	p.next()
+	value, err := p.parseArgument()
+	if err != nil {
+		return nil, err
+	}
+
+	return &NamedArg{node: p.node(name.Pos), Name: name.Text, Value: value}, nil
+
+}
+
+// unclosed replaces an error at the end of the input with an error at the bracket that was never closed
+// as the end of the input is not where the missing bracket belongs
+func (p *Parser) unclosed(open Token, err *error) {
+	if *err == nil || p.peek().Kind != TokenEOF {
+		return
+	}
+	if syntaxError, ok := (*err).(*SyntaxError); ok && syntaxError.Pos == p.peek().Pos {
+		*err = p.errorf(open, "unbalanced brackets, %v is never closed", describe(open))
+	}
+}
+
+// synchronize skips past a statement that could not be parsed
+// Parsing resumes at the next '[' that is the first token on its line
+func (p *Parser) synchronize(start int) {
+	if p.index == start {
+		p.next()
+	}
+	for p.peek().Kind != TokenEOF {
+		token := p.peek()
+		if token.Kind == TokenLBracket && p.tokens[p.index-1].Pos.Line < token.Pos.Line {
+			return
+		}
+		p.next()
+	}
+}
+
+// expect consumes the next token if it is of the given kind and returns an error otherwise
+func (p *Parser) expect(kind TokenKind) (Token, error) {
+	token := p.peek()
+	if token.Kind == TokenIllegal {
+		return token, p.errorf(token, "%v", token.Value)
+	}
+	if token.Kind != kind {
+		return token, p.errorf(token, "expected %v but found %v", kind, describe(token))
+	}
+	p.next()
+	return token, nil
+}
+
+// peek returns the current token without consuming it
+func (p *Parser) peek() Token {
+	return p.tokens[p.index]
+}
+
+// peekAt returns the token n tokens after the current token without consuming anything
+func (p *Parser) peekAt(n int) Token {
+	if p.index+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.index+n]
+}
+
+// isCall returns true if the current token starts a data function call
+func (p *Parser) isCall() bool {
+	return p.peek().Kind == TokenLBracket && p.peekAt(1).Kind == TokenIdent && p.peekAt(2).Kind == TokenLParen
+}
+
+// adjacent returns true if the current token directly follows the last consumed token
+func (p *Parser) adjacent() bool {
+	if p.index == 0 {
+		return false
+	}
+	last := p.tokens[p.index-1]
+	return last.Pos.Offset+len(last.Text) == p.peek().Pos.Offset
+}
+
+// next consumes the current token
+// The final TokenEOF is never consumed
+func (p *Parser) next() Token {
+	token := p.tokens[p.index]
+	if token.Kind != TokenEOF {
+		p.index++
+	}
+	return token
+}
+
+// node creates the shared node fields for a node starting at the given position
+// and ending at the last consumed token
+func (p *Parser) node(start Pos) node {
+	end := start.Offset
+	if p.index > 0 {
+		last := p.tokens[p.index-1]
+		end = last.Pos.Offset + len(last.Text)
+	}
+	if end < start.Offset {
+		end = start.Offset
+	}
+	return node{pos: start, raw: p.src[start.Offset:end]}
+}
+
+// errorf creates a SyntaxError located at the given token
+func (p *Parser) errorf(token Token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: token.Pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// describe returns a human readable description of a token for error messages
+func describe(token Token) string {
+	if token.Kind == TokenEOF {
+		return token.Kind.String()
+	}
+	return fmt.Sprintf("%q", token.Text)
+}
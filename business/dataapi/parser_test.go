@@ -0,0 +1,133 @@
+package dataapi_test
+
+import (
+	"testing"
+
+	"github.com/Celbux/dataapi/business/dataapi"
+)
+
+func TestLexStringLiteral(t *testing.T) {
+	t.Log("should lex brackets, commas and escaped quotes inside a string as a single token")
+
+	tokens := dataapi.Lex("", `[PrintF("a ] , ( \"b\"\n", x)]`)
+
+	assertInt(t, 9, len(tokens))
+	assertString(t, "string", tokens[3].Kind.String())
+	assertString(t, "a ] , ( \"b\"\n", tokens[3].Value)
+	assertInt(t, 9, tokens[3].Pos.Col)
+}
+
+func TestParseScriptPositions(t *testing.T) {
+	t.Log("should parse every top level call as a statement with its source position")
+
+	src := "# comment\n[Set(i, 0, int)]\n  [PrintF(\"%v\", i)][Pass(\"\")]\n"
+	script := dataapi.ParseScript("test.txt", src)
+
+	assertInt(t, 3, len(script.Statements))
+	assertInt(t, 0, len(script.Errors()))
+	assertString(t, "[Set(i, 0, int)]", script.Statements[0].String())
+	assertString(t, "test.txt:2:1", script.Statements[0].Pos().String())
+	assertString(t, `[PrintF("%v", i)]`, script.Statements[1].String())
+	assertString(t, "test.txt:3:3", script.Statements[1].Pos().String())
+	assertString(t, "test.txt:3:20", script.Statements[2].Pos().String())
+}
+
+func TestParseBlock(t *testing.T) {
+	t.Log("should parse calls written next to each other inside a parameter as a block")
+
+	node, err := dataapi.ParseExpression("", `[For(i < size, [If(i%2 == 0, [PrintF("%v", i)])][Set(i, i+1, int)])]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call, ok := node.(*dataapi.Call)
+	if !ok {
+		t.Fatalf("expected a call but got %T", node)
+	}
+	assertString(t, "For", call.Name)
+	assertInt(t, 2, len(call.Args))
+	assertString(t, "i < size", call.Args[0].String())
+	block, ok := call.Args[1].(*dataapi.Block)
+	if !ok {
+		t.Fatalf("expected a block but got %T", call.Args[1])
+	}
+	assertInt(t, 2, len(block.Calls))
+	assertString(t, "[Set(i, i+1, int)]", block.Calls[1].String())
+}
+
+func TestParseListIndex(t *testing.T) {
+	t.Log("should parse list literals, types and indexes without confusing them with calls")
+
+	node, err := dataapi.ParseExpression("", `[Set(a, [[Res("res")][0], b[i+1]][0], []string)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := node.(*dataapi.Call)
+	assertInt(t, 3, len(call.Args))
+	index, ok := call.Args[1].(*dataapi.Index)
+	if !ok {
+		t.Fatalf("expected an index but got %T", call.Args[1])
+	}
+	list, ok := index.X.(*dataapi.List)
+	if !ok {
+		t.Fatalf("expected a list but got %T", index.X)
+	}
+	assertInt(t, 2, len(list.Items))
+	assertString(t, `[Res("res")][0]`, list.Items[0].String())
+	assertString(t, "b[i+1]", list.Items[1].String())
+	assertString(t, "[]string", call.Args[2].(*dataapi.Ident).Name)
+}
+
+func TestParseNamedArgs(t *testing.T) {
+	t.Log("should parse named parameters of a call without confusing them with comparisons")
+
+	node, err := dataapi.ParseExpression("", `[Evaluate("pay.txt", storeID="Store1", ok=amount==2000)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := node.(*dataapi.Call)
+	assertInt(t, 3, len(call.Args))
+	named, ok := call.Args[2].(*dataapi.NamedArg)
+	if !ok {
+		t.Fatalf("expected a named parameter but got %T", call.Args[2])
+	}
+	assertString(t, "ok", named.Name)
+	assertString(t, "amount==2000", named.Value.String())
+	assertString(t, `storeID="Store1"`, call.Args[1].String())
+}
+
+func TestParseTemplate(t *testing.T) {
+	t.Log("should parse the placeholders of a string literal with their positions")
+
+	node, err := dataapi.ParseExpression("test.txt", `"id: {{res.IDs[0]}}"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, ok := node.(*dataapi.Template)
+	if !ok {
+		t.Fatalf("expected a template but got %T", node)
+	}
+	assertInt(t, 2, len(template.Parts))
+	assertString(t, "res.IDs[0]", template.Parts[1].String())
+	assertString(t, "test.txt:1:8", template.Parts[1].Pos().String())
+
+	_, err = dataapi.ParseExpression("test.txt", `"{{name"`)
+	assertString(t, "test.txt:1:1: unterminated {{ in string literal", err.Error())
+}
+
+func TestParseScriptRecovers(t *testing.T) {
+	t.Log("should report a syntax error with its position and continue parsing on the next line")
+
+	src := "[Set(a, \"unterminated, string)]\n[Set(b, 1, int)]\n[Set(c, (1, int)]\n"
+	script := dataapi.ParseScript("test.txt", src)
+
+	assertInt(t, 3, len(script.Statements))
+	errs := script.Errors()
+	assertInt(t, 2, len(errs))
+	assertString(t, "test.txt:1:9: unterminated string literal", errs[0].Error())
+	assertString(t, "test.txt:3:17: expected ')' but found \"]\"", errs[1].Error())
+	assertString(t, "[Set(b, 1, int)]", script.Statements[1].String())
+}
@@ -0,0 +1,327 @@
+package dataapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRegistry holds the data functions used by every DataAPIService that has no Registry of its own
+// It starts out with all the built in data functions
+var DefaultRegistry *Registry
+
+func init() {
+	DefaultRegistry = NewRegistry()
+}
+
+// DataFunc is the Go implementation of a data function
+// It is given the service the call is evaluated on and the parameters of the call,
+// evaluated and converted as declared by the Signature of the data function
+// A data function fails when it returns a non nil error
+type DataFunc func(d DataAPIService, args []interface{}) (interface{}, error)
+
+// ParamType declares how a parameter is evaluated before it is given to a DataFunc
+type ParamType int
+
+const (
+	// TypeAny parameters are evaluated and given as is
+	TypeAny ParamType = iota
+	// TypeString parameters are evaluated and given as a string
+	TypeString
+	// TypeInt parameters are evaluated and given as an int
+	TypeInt
+	// TypeBool parameters are evaluated and given as a bool
+	TypeBool
+	// TypeList parameters are evaluated and given as a []interface{}
+	TypeList
+	// TypeCode parameters are not evaluated and given as the Node of the parameter
+	// Use it for code the data function runs itself and for the names of variables
+	TypeCode
+)
+
+// String returns the name of the parameter type
+func (t ParamType) String() string {
+	switch t {
+	case TypeAny:
+		return "any"
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeBool:
+		return "boolean"
+	case TypeList:
+		return "list"
+	case TypeCode:
+		return "code"
+	}
+	return "unknown"
+}
+
+// Param declares a single parameter of a data function
+// Optional parameters may be left out of a call
+type Param struct {
+	Name     string
+	Type     ParamType
+	Optional bool
+}
+
+// Signature declares the parameters of a data function along with its help text
+// When Variadic is true the last parameter may be repeated any number of times
+// Eg: PrintF has the parameters format and values with Variadic set, so it accepts 1 or more parameters
+// When Named is true any number of named parameters may follow the other parameters, Eg: storeID="Store1"
+// Named parameters are not evaluated and are given to the DataFunc as *NamedArg after the other parameters
+type Signature struct {
+	Params   []Param
+	Variadic bool
+	Named    bool
+	Help     string
+}
+
+// arity returns the number of parameters the signature accepts
+func (s Signature) arity() arity {
+	a := arity{}
+	for _, param := range s.Params {
+		if !param.Optional {
+			a.min++
+		}
+		a.max++
+	}
+	if s.Variadic {
+		a.max = -1
+	}
+	return a
+}
+
+// params returns the declarations of the parameters of a call with n parameters
+// Optional parameters are left out from the last to the first until the call and the declarations line up
+// Eg: ForEach([index], item, collection, body) called with 3 parameters has no index
+func (s Signature) params(n int) []Param {
+	params := append([]Param{}, s.Params...)
+	for i := len(params) - 1; i >= 0 && len(params) > n; i-- {
+		if params[i].Optional {
+			params = append(params[:i], params[i+1:]...)
+		}
+	}
+	return params
+}
+
+// DataFunction is a data function registered on a Registry
+type DataFunction struct {
+	Name      string
+	Func      DataFunc
+	Signature Signature
+}
+
+// Usage returns how the data function is called
+// Eg: PrintF(format string, values any...)
+func (f *DataFunction) Usage() string {
+	var params []string
+	for i, param := range f.Signature.Params {
+		p := fmt.Sprintf("%v %v", param.Name, param.Type)
+		if f.Signature.Variadic && i == len(f.Signature.Params)-1 {
+			p += "..."
+		}
+		if param.Optional {
+			p = "[" + p + "]"
+		}
+		params = append(params, p)
+	}
+	if f.Signature.Named {
+		params = append(params, "[name=value...]")
+	}
+	return fmt.Sprintf("%v(%v)", f.Name, strings.Join(params, ", "))
+}
+
+// arity is the number of parameters a data function accepts
+// A max of -1 means there is no upper limit
+type arity struct {
+	min int
+	max int
+}
+
+// String describes the number of parameters for error messages
+func (a arity) String() string {
+	switch {
+	case a.min == a.max:
+		return fmt.Sprintf("%v", a.min)
+	case a.max < 0:
+		return fmt.Sprintf("at least %v", a.min)
+	}
+	return fmt.Sprintf("%v to %v", a.min, a.max)
+}
+
+// accepts returns true if n parameters are accepted
+func (a arity) accepts(n int) bool {
+	return n >= a.min && (a.max < 0 || n <= a.max)
+}
+
+// Registry holds the data functions that can be called from data code
+// Registries are safe to use from multiple goroutines
+type Registry struct {
+	mu        sync.RWMutex
+	functions map[string]*DataFunction
+}
+
+// NewRegistry creates a Registry that holds all the built in data functions
+func NewRegistry() *Registry {
+	r := &Registry{functions: make(map[string]*DataFunction)}
+	registerBuiltins(r)
+	return r
+}
+
+// Register adds a data function to the DefaultRegistry
+// Eg: dataapi.Register("Balance", balance, dataapi.Signature{
+//		Params: []dataapi.Param{{Name: "wallet", Type: dataapi.TypeString}},
+//		Help:   "Balance returns the balance of the given wallet",
+//	})
+// The data function can then be called from data code with [Balance("wallet1")]
+func Register(name string, fn DataFunc, signature Signature) error {
+	return DefaultRegistry.Register(name, fn, signature)
+}
+
+// Register adds a data function to the registry
+// The name must be a valid identifier that is not registered yet
+func (r *Registry) Register(name string, fn DataFunc, signature Signature) error {
+
+	// Ensure the data function can be called from data code
+	if !isIdentifier(name) {
+		return errors.Errorf("data function name %q is not a valid identifier", name)
+	}
+	if fn == nil {
+		return errors.Errorf("data function %v has no implementation", name)
+	}
+	if signature.Variadic && len(signature.Params) == 0 {
+		return errors.Errorf("data function %v is variadic but has no parameters", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.functions[name]; ok {
+		return errors.Errorf("data function %v is already registered", name)
+	}
+	r.functions[name] = &DataFunction{Name: name, Func: fn, Signature: signature}
+
+	return nil
+
+}
+
+// Lookup returns the data function registered under the given name
+func (r *Registry) Lookup(name string) (*DataFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	function, ok := r.functions[name]
+	return function, ok
+}
+
+// Names returns the names of all the registered data functions in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.functions))
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registry returns the registry of the service, or the DefaultRegistry if the service has none
+func (d DataAPIService) registry() *Registry {
+	if d.Registry == nil {
+		return DefaultRegistry
+	}
+	return d.Registry
+}
+
+// evalArgs evaluates the parameters of a call as declared by the signature of the data function
+func (d DataAPIService) evalArgs(signature Signature, parameters []Node) ([]interface{}, error) {
+
+	// The parameters past the declared parameters of a variadic data function take the last declaration
+	params := signature.params(len(parameters))
+	args := make([]interface{}, len(parameters))
+	for i, parameter := range parameters {
+		param := Param{Type: TypeAny}
+		switch {
+		case i < len(params):
+			param = params[i]
+		case len(params) > 0:
+			param = params[len(params)-1]
+		}
+		var err error
+		switch param.Type {
+		case TypeCode:
+			args[i] = parameter
+		case TypeString:
+			args[i], err = d.EvalString(parameter)
+		case TypeInt:
+			args[i], err = d.EvalInt(parameter)
+		case TypeBool:
+			args[i], err = d.EvalBool(parameter)
+		case TypeList:
+			var val interface{}
+			val, err = d.EvalNode(parameter)
+			if err == nil {
+				args[i], err = toList(val)
+			}
+		default:
+			args[i], err = d.EvalNode(parameter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+
+}
+
+// evalNamed evaluates the named parameters given to a data function that accepts named parameters
+func (d DataAPIService) evalNamed(named []interface{}) ([]Argument, error) {
+
+	args := make([]Argument, len(named))
+	for i, arg := range named {
+		arg := arg.(*NamedArg)
+		val, err := d.EvalNode(arg.Value)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = Argument{Name: arg.Name, Value: val}
+	}
+
+	return args, nil
+
+}
+
+// splitNamed separates the named parameters of a call from its other parameters
+// Named parameters must come after all the other parameters
+func splitNamed(parameters []Node) ([]Node, []Node, error) {
+
+	for i, parameter := range parameters {
+		if _, ok := parameter.(*NamedArg); !ok {
+			continue
+		}
+		for _, named := range parameters[i+1:] {
+			if _, ok := named.(*NamedArg); !ok {
+				return nil, nil, errors.Errorf("parameter %v must come before the named parameters", named)
+			}
+		}
+		return parameters[:i], parameters[i:], nil
+	}
+
+	return parameters, nil, nil
+
+}
+
+// isIdentifier returns true if the name can be used as a data function name in data code
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			return false
+		}
+	}
+	return name != ""
+}
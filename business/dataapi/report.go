@@ -0,0 +1,79 @@
+package dataapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Celbux/dataapi/foundation/tools"
+)
+
+// describeArgs describes the named parameters a file is Evaluated with for its report node
+// Eg: (storeID=Store1, amount=2000)
+func describeArgs(args []Argument) string {
+	if len(args) == 0 {
+		return ""
+	}
+	described := make([]string, len(args))
+	for i, arg := range args {
+		described[i] = fmt.Sprintf("%v=%v", arg.Name, arg.Value)
+	}
+	return "(" + strings.Join(described, ", ") + ")"
+}
+
+// reportNode creates the report node for a statement in a data code file
+// The node carries the position of the statement so failures map back to the source
+func reportNode(statement Node) *tools.Tree {
+	pos := statement.Pos()
+	return &tools.Tree{Data: statement.String(), File: pos.File, Line: pos.Line, Col: pos.Col}
+}
+
+// addFailure adds the error a statement failed with to the report node of the statement
+// Calls that failed inside the statement, such as a call in the body of a For or If,
+// are added as child nodes that carry the position of the nested call
+// Every node on the way to a call that timed out is marked as timed out
+func addFailure(parent *tools.Tree, err error) {
+	switch err := err.(type) {
+	case *EvalError:
+		if err.Pos.File == parent.File && err.Pos.Line == parent.Line && err.Pos.Col == parent.Col {
+			addFailure(parent, err.Err)
+			return
+		}
+		node := &tools.Tree{Data: err.Call, File: err.Pos.File, Line: err.Pos.Line, Col: err.Pos.Col}
+		addFailure(node, err.Err)
+		parent.AddNode(node)
+		parent.TimedOut = parent.TimedOut || node.TimedOut
+	case EvalErrors:
+		for _, e := range err {
+			addFailure(parent, e)
+		}
+	case *RowsError:
+		for i, name := range err.Names {
+			node := &tools.Tree{Data: name}
+			if err.Errs[i] == nil {
+				node.AddNode(&tools.Tree{Data: "[Pass()]"})
+			} else {
+				addFailure(node, err.Errs[i])
+			}
+			parent.AddNode(node)
+			parent.TimedOut = parent.TimedOut || node.TimedOut
+		}
+	case *TimeoutError:
+		parent.TimedOut = true
+		parent.AddNode(&tools.Tree{Data: err.Error()})
+	default:
+		parent.AddNode(&tools.Tree{Data: err.Error()})
+	}
+}
+
+// addPass marks the report node of a statement that passed
+// The rows run by ForEachRow are added as passing child nodes
+func addPass(node *tools.Tree, val interface{}) {
+	rows, ok := val.(Rows)
+	if !ok || len(rows) == 0 {
+		node.AddNode(&tools.Tree{Data: "[Pass()]"})
+		return
+	}
+	for _, name := range rows {
+		node.AddNode(&tools.Tree{Data: name, Nodes: []*tools.Tree{{Data: "[Pass()]"}}})
+	}
+}
@@ -0,0 +1,121 @@
+package dataapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/Celbux/dataapi/business/i"
+	"github.com/Celbux/dataapi/foundation/tools"
+	"github.com/pkg/errors"
+)
+
+// redacted replaces the value of every secret in logs, reports and failures
+const redacted = "*****"
+
+// LoadSecrets reads the secrets of the Data API from a local secrets file
+// A .json file holds a JSON object of names to values, any other file holds a NAME=VALUE pair per line
+// Eg: TOKEN=9m1
+// Empty lines and lines starting with # are ignored, and values may be wrapped in quotes
+func LoadSecrets(filepath string) (map[string]string, error) {
+
+	dataRaw, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading secrets file")
+	}
+	secrets := make(map[string]string)
+	if strings.HasSuffix(filepath, ".json") {
+		err = json.Unmarshal(dataRaw, &secrets)
+		if err != nil {
+			return nil, errors.Wrapf(err, "secrets file %v is not a JSON object of strings", filepath)
+		}
+		return secrets, nil
+	}
+	for n, line := range strings.Split(string(dataRaw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.Errorf("secrets file %v line %v is not in the format NAME=VALUE", filepath, n+1)
+		}
+		value := strings.TrimSpace(keyValue[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		secrets[strings.TrimSpace(keyValue[0])] = value
+	}
+
+	return secrets, nil
+
+}
+
+// addSecret records a secret value so that it is redacted for the rest of the run
+// Every secret that is not empty is redacted, no matter how short
+func (r *Run) addSecret(value string) {
+	if value == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		if secret == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, value)
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// redact replaces every secret value of the run in the string
+// Longer secrets are replaced first so that a secret holding another secret is replaced as a whole
+func (r *Run) redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	return s
+}
+
+// redactError returns the error with every secret value of the run redacted from its message
+// The original error is wrapped in a RedactedError so that its type survives,
+// and it is returned as is when its message holds no secrets
+func (r *Run) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if message := r.redact(err.Error()); message != err.Error() {
+		return &RedactedError{Msg: message, Err: err}
+	}
+	return err
+}
+
+// redactTree redacts every secret value of the run from a report
+func (r *Run) redactTree(tree *tools.Tree) {
+	tree.Data = r.redact(tree.Data)
+	for _, node := range tree.Nodes {
+		r.redactTree(node)
+	}
+}
+
+// redactLogger is a logger that redacts the secret values of a run from everything it logs
+type redactLogger struct {
+	log i.Logger
+	run *Run
+}
+
+// Println logs the values with the secrets redacted
+func (l redactLogger) Println(v ...interface{}) {
+	l.log.Println(l.run.redact(strings.TrimSuffix(fmt.Sprintln(v...), "\n")))
+}
+
+// Printf logs the formatted values with the secrets redacted
+func (l redactLogger) Printf(format string, v ...interface{}) {
+	l.log.Printf("%s", l.run.redact(fmt.Sprintf(format, v...)))
+}
@@ -0,0 +1,193 @@
+package dataapi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// timeLayouts are the names of layouts that can be used instead of a Go time layout
+// Eg: [Now("DateTime")] instead of [Now("2006-01-02 15:04:05")]
+// The names unix and unixmilli format and parse seconds and milliseconds since 1970 instead
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"ANSIC":       time.ANSIC,
+	"DateTime":    "2006-01-02 15:04:05",
+	"Date":        "2006-01-02",
+	"Time":        "15:04:05",
+}
+
+// Time is a point in time set with the time type or returned by the time data functions
+// It prints in RFC3339Nano so that it can be used in templates and JSON as is,
+// which is RFC3339 with the fraction of a second only when there is one
+// Eg: 2021-06-01T10:00:00+02:00 or 2021-06-01T10:00:00.5+02:00
+type Time struct {
+	time.Time
+}
+
+// String returns the time in RFC3339Nano
+func (t Time) String() string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// now returns the current time, or the frozen clock of the service when it is set
+func (d DataAPIService) now() Time {
+	if !d.Clock.IsZero() {
+		return Time{d.Clock}
+	}
+	return Time{time.Now()}
+}
+
+// layout returns the Go time layout of a layout name, any other layout is returned as is
+func layout(name string) string {
+	if layout, ok := timeLayouts[name]; ok {
+		return layout
+	}
+	return name
+}
+
+// formatTime formats a time with the layout
+func formatTime(t Time, name string) string {
+	switch name {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return t.Format(layout(name))
+}
+
+// parseTime parses a time with the layout
+func parseTime(s string, name string) (Time, error) {
+
+	s = strings.TrimSpace(s)
+	switch name {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return Time{}, errors.Errorf("%v is not a %v time", s, name)
+		}
+		if name == "unixmilli" {
+			return Time{time.Unix(0, n*int64(time.Millisecond))}, nil
+		}
+		return Time{time.Unix(n, 0)}, nil
+	}
+	t, err := time.Parse(layout(name), s)
+	if err != nil {
+		return Time{}, errors.Errorf("%v does not match the time layout %v", s, name)
+	}
+
+	return Time{t}, nil
+
+}
+
+// toTime converts times and RFC3339 strings to a Time
+func toTime(v interface{}) (Time, error) {
+	switch v := v.(type) {
+	case Time:
+		return v, nil
+	case time.Time:
+		return Time{v}, nil
+	case string:
+		t, err := parseTime(v, "RFC3339")
+		if err != nil {
+			return Time{}, errors.Errorf("%v is not an RFC3339 time", v)
+		}
+		return t, nil
+	}
+	return Time{}, errors.Errorf("%v is not a time", v)
+}
+
+// toDuration converts durations, duration strings and numbers of seconds to a time.Duration
+// Eg: "24h", "1h30m", "500ms" or 5
+func toDuration(v interface{}) (time.Duration, error) {
+
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		duration, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return 0, errors.Errorf("%v is not a duration", v)
+		}
+		return duration, nil
+	}
+	seconds, ok := toFloat(v)
+	if !ok {
+		return 0, errors.Errorf("%v is not a duration", v)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+
+}
+
+// timeOp applies an operator to times and durations
+// A duration can be added to or subtracted from a time, two times subtract to the duration between them,
+// and times and durations compare to values of the same type
+// ok is false when neither value is a time or duration, or one is a string, so that the operator is applied as usual
+func timeOp(op string, x interface{}, y interface{}) (interface{}, bool, error) {
+
+	xTime, xIsTime := x.(Time)
+	yTime, yIsTime := y.(Time)
+	xDuration, xIsDuration := x.(time.Duration)
+	yDuration, yIsDuration := y.(time.Duration)
+	switch {
+	case xIsTime && yIsDuration:
+		switch op {
+		case "+":
+			return Time{xTime.Add(yDuration)}, true, nil
+		case "-":
+			return Time{xTime.Add(-yDuration)}, true, nil
+		}
+	case xIsTime && yIsTime:
+		switch op {
+		case "-":
+			return xTime.Sub(yTime.Time), true, nil
+		case "==":
+			return xTime.Equal(yTime.Time), true, nil
+		case "!=":
+			return !xTime.Equal(yTime.Time), true, nil
+		case "<":
+			return xTime.Before(yTime.Time), true, nil
+		case "<=":
+			return !xTime.After(yTime.Time), true, nil
+		case ">":
+			return xTime.After(yTime.Time), true, nil
+		case ">=":
+			return !xTime.Before(yTime.Time), true, nil
+		}
+	case xIsDuration && yIsDuration:
+		switch op {
+		case "+":
+			return xDuration + yDuration, true, nil
+		case "-":
+			return xDuration - yDuration, true, nil
+		case "==":
+			return xDuration == yDuration, true, nil
+		case "!=":
+			return xDuration != yDuration, true, nil
+		case "<":
+			return xDuration < yDuration, true, nil
+		case "<=":
+			return xDuration <= yDuration, true, nil
+		case ">":
+			return xDuration > yDuration, true, nil
+		case ">=":
+			return xDuration >= yDuration, true, nil
+		}
+	}
+	_, xIsString := x.(string)
+	_, yIsString := y.(string)
+	if xIsString || yIsString || (!xIsTime && !yIsTime && !xIsDuration && !yIsDuration) {
+		return nil, false, nil
+	}
+
+	return nil, true, errors.Errorf("operator %v not defined on %v and %v", op, x, y)
+
+}
@@ -1,14 +1,256 @@
 package dataapi
 
 import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
 	"github.com/Celbux/dataapi/business/i"
 )
 
 // DataAPIService encapsulates all dependencies required by the DataAPI
 // This service is used to run data driven functionality at run time
+// EvalCache holds the global variables while Scope is the innermost scope
+// that is currently being evaluated, such as an Evaluated file or a function body
+// Run holds the state that is shared by the whole evaluation
+// Registry holds the data functions that can be called, the DefaultRegistry is used when it is nil
+// Core is the core backend that data functions which are not found are called on, it is optional
+// Limits stop data code that runs for too long, the default limits are used when they are 0
+// Seed makes the random data generated by a run repeatable, a new seed is picked for every run when it is 0
+// Clock freezes the time returned by Now when it is set, so that runs that use the time are repeatable
+// Secrets holds the values returned by Secret by name, the environment is used for secrets that are not in it
+// ctx is the context of the code that is currently being evaluated and timeout is the limit
+// of the innermost Timeout that applies to it, 0 when the deadline was not set by data code
 type DataAPIService struct {
+	Clock     time.Time
+	Core      CoreDataAPI
 	EvalCache EvalCache
+	Limits    Limits
 	Log       i.Logger
+	Registry  *Registry
+	Scope     *Scope
+	Secrets   map[string]string
+	Seed      int64
+	Run       *Run
+	ctx       context.Context
+	timeout   time.Duration
 }
 
 type EvalCache map[string]interface{}
+
+const (
+	// DefaultMaxIterations is the number of iterations a For or While loop may run by default
+	DefaultMaxIterations = 10000
+	// DefaultMaxSteps is the number of expressions a run may evaluate by default
+	DefaultMaxSteps = 1000000
+)
+
+// Limits stop runaway data code, such as a For loop whose condition never becomes false
+// MaxIterations is the number of iterations a single For or While loop may run
+// MaxSteps is the number of expressions a whole run may evaluate, across every Evaluated file
+// A limit of 0 uses the default limit
+type Limits struct {
+	MaxIterations int
+	MaxSteps      int
+}
+
+// maxIterations returns the iteration limit of a loop
+func (l Limits) maxIterations() int {
+	if l.MaxIterations <= 0 {
+		return DefaultMaxIterations
+	}
+	return l.MaxIterations
+}
+
+// maxSteps returns the expression limit of a run
+func (l Limits) maxSteps() int {
+	if l.MaxSteps <= 0 {
+		return DefaultMaxSteps
+	}
+	return l.MaxSteps
+}
+
+// Scope is a single level of variables layered over its parent
+// Every Evaluated file and user defined function runs in its own scope and
+// every iteration of a loop body runs in a block scope
+// Variables are looked up from the innermost scope outwards
+// args holds the names of the named parameters an Evaluated file was called with
+type Scope struct {
+	Vars    EvalCache
+	Parent  *Scope
+	Block   bool
+	globals map[string]bool
+	args    map[string]bool
+}
+
+// NewScope creates an empty scope layered over the given parent
+// Variables set in the scope shadow the variables of the parent
+func NewScope(parent *Scope) *Scope {
+	return &Scope{Vars: make(EvalCache), Parent: parent}
+}
+
+// NewBlockScope creates an empty block scope layered over the given parent
+// Setting a variable that already exists in the enclosing file or function
+// updates it, while new variables only live as long as the block
+func NewBlockScope(parent *Scope) *Scope {
+	return &Scope{Vars: make(EvalCache), Parent: parent, Block: true}
+}
+
+// Get returns the value of the variable from the innermost scope that defines it
+// Variables declared global are always read from the global scope
+func (s *Scope) Get(name string) (interface{}, bool) {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if scope.globals[name] {
+			val, ok := scope.root().Vars[name]
+			return val, ok
+		}
+		val, ok := scope.Vars[name]
+		if ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// Set assigns the variable
+// A variable that exists in the enclosing file or function is updated, otherwise it is
+// defined on this scope, so a variable with the same name in a parent file is shadowed
+// Variables declared global are always written to the global scope
+func (s *Scope) Set(name string, value interface{}) {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if scope.globals[name] {
+			scope.root().Vars[name] = value
+			return
+		}
+		if _, ok := scope.Vars[name]; ok {
+			scope.Vars[name] = value
+			return
+		}
+		if !scope.Block {
+			break
+		}
+	}
+	s.Vars[name] = value
+}
+
+// Define creates the variable on this scope, shadowing any variable with the same name
+func (s *Scope) Define(name string, value interface{}) {
+	s.Vars[name] = value
+}
+
+// Global declares that the variable refers to the global variable for the rest of the
+// enclosing file or function
+func (s *Scope) Global(name string) {
+	scope := s.boundary()
+	if scope.globals == nil {
+		scope.globals = make(map[string]bool)
+	}
+	scope.globals[name] = true
+}
+
+// Export sets the variable on the scope the enclosing file or function was called from
+func (s *Scope) Export(name string) bool {
+	val, ok := s.Get(name)
+	if !ok {
+		return false
+	}
+	scope := s.boundary()
+	if scope.Parent != nil {
+		scope.Parent.Set(name, val)
+	}
+	return true
+}
+
+// boundary returns the scope of the enclosing file or function
+func (s *Scope) boundary() *Scope {
+	scope := s
+	for scope.Block && scope.Parent != nil {
+		scope = scope.Parent
+	}
+	return scope
+}
+
+// root returns the global scope
+func (s *Scope) root() *Scope {
+	scope := s
+	for scope.Parent != nil {
+		scope = scope.Parent
+	}
+	return scope
+}
+
+// Function is a data function defined in data code with Func
+// Scope is the scope the function was defined in, which the body of the function can see
+type Function struct {
+	Name   string
+	Params []string
+	Body   Node
+	Result Node
+	Scope  *Scope
+}
+
+// Argument is a named parameter given to a data function
+// Eg: storeID="Store1" = Argument{Name: "storeID", Value: "Store1"}
+type Argument struct {
+	Name  string
+	Value interface{}
+}
+
+// Rows is returned by ForEachRow when the body passed for every row
+// It holds the name of every row so the report shows a node for every row
+type Rows []string
+
+// Run holds the state shared by everything evaluated in a single Data API run
+// imports caches the scope of every library loaded with Import by file path
+// importing is the chain of libraries currently being loaded, used to detect import cycles
+// steps is the number of expressions evaluated so far
+// Seed is the seed of all the random data generated in the run, running data code again
+// with the same seed generates the same data, and sequences holds the last number of every Sequence
+// secrets holds the values returned by Secret, which are redacted from the logs, report and failures of the run
+type Run struct {
+	imports   map[string]*Scope
+	importing []string
+	steps     int64
+	Seed      int64
+	mu        sync.Mutex
+	random    *rand.Rand
+	sequences map[string]int
+	secrets   []string
+}
+
+// NewRun creates the state for a new Data API run
+// A seed of 0 picks a new seed for the run
+func NewRun(seed int64) *Run {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Run{
+		imports:   make(map[string]*Scope),
+		Seed:      seed,
+		random:    rand.New(rand.NewSource(seed)),
+		sequences: make(map[string]int),
+	}
+}
+
+// intn returns a random int in [0, n)
+func (r *Run) intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.random.Intn(n)
+}
+
+// Read fills p with random bytes so the random data of the run can be used as an io.Reader
+func (r *Run) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.random.Read(p)
+}
+
+// next returns the next number of the named sequence, starting at 1
+func (r *Run) next(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequences[name]++
+	return r.sequences[name]
+}
@@ -0,0 +1,87 @@
+package dataapi_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Celbux/dataapi/business/dataapi"
+)
+
+// newService creates a DataAPIService with an empty EvalCache
+// Everything the service logs is written to the returned buffer
+func newService() (dataapi.DataAPIService, *bytes.Buffer) {
+	var buf bytes.Buffer
+	service := dataapi.DataAPIService{
+		EvalCache: make(map[string]interface{}),
+		Log:       log.New(&buf, "", 0),
+	}
+	return service, &buf
+}
+
+// writeScripts creates the given data code files under configs/dataapi in a
+// temporary directory and changes the working directory to it for the test
+func writeScripts(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, "configs", "dataapi", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
+
+// Assert Functions
+func assertString(t *testing.T, want, got string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("wanted %q but got %q", want, got)
+	}
+}
+
+func assertInt(t *testing.T, want, got int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("wanted %d but got %d", want, got)
+	}
+}
+
+func assertStrings(t *testing.T, want, got []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("wanted %q but got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("wanted %q but got %q", want, got)
+			return
+		}
+	}
+}
+
+func assertContains(t *testing.T, substring, got string) {
+	t.Helper()
+	if !strings.Contains(got, substring) {
+		t.Errorf("wanted %q to contain %q", got, substring)
+	}
+}
@@ -0,0 +1,396 @@
+package dataapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// toList converts a collection to the list of its items
+// Lists are returned as is, strings holding a JSON array are decoded and
+// any other string is split on "___" for backwards compatibility
+// A Response is converted through its res array or body
+func toList(v interface{}) ([]interface{}, error) {
+
+	if res, ok := v.(Response); ok {
+		v = res.value()
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		return v, nil
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = item
+		}
+		return out, nil
+	case []int:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = item
+		}
+		return out, nil
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if trimmed == "" {
+			return nil, nil
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			val, err := parseJSON(trimmed)
+			if list, ok := val.([]interface{}); ok && err == nil {
+				return list, nil
+			}
+		}
+		var out []interface{}
+		for _, item := range strings.Split(v, "___") {
+			out = append(out, item)
+		}
+		return out, nil
+	}
+
+	return nil, errors.Errorf("%v is not a collection", v)
+
+}
+
+// parseJSON decodes a JSON document into maps, lists, strings, booleans and numbers
+// Whole numbers are decoded as int and all other numbers as float64
+func parseJSON(s string) (interface{}, error) {
+
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var val interface{}
+	err := decoder.Decode(&val)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromJSON(val), nil
+
+}
+
+// fromJSON converts the json.Number values of a decoded JSON document to int or float64
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = fromJSON(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = fromJSON(val)
+		}
+		return v
+	case json.Number:
+		i, err := v.Int64()
+		if err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// toStrings converts a collection to a list of strings
+// Every item is converted to its printed value
+func toStrings(v interface{}) ([]string, error) {
+
+	items, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = fmt.Sprintf("%v", item)
+	}
+
+	return out, nil
+
+}
+
+// toInts converts a collection to a list of ints
+func toInts(v interface{}) ([]int, error) {
+
+	items, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int, len(items))
+	for i, item := range items {
+		val, ok := toInt(item)
+		if !ok {
+			return nil, errors.Errorf("item %v of the list is not an int: %v", i, item)
+		}
+		out[i] = val
+	}
+
+	return out, nil
+
+}
+
+// toInt converts ints, whole floats and decimals and numeric strings to an int
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	case Decimal:
+		if v.r().IsInt() && v.r().Num().IsInt64() {
+			return int(v.r().Num().Int64()), true
+		}
+	case string:
+		val, err := strconv.Atoi(strings.TrimSpace(v))
+		return val, err == nil
+	}
+	return 0, false
+}
+
+// toNumber converts numbers and numeric strings to a float64 or an exact Decimal
+// The numberType is either "float" or "decimal"
+func toNumber(v interface{}, numberType string) (interface{}, error) {
+
+	if raw, ok := v.(string); ok {
+		decimal, err := NewDecimal(raw)
+		if err != nil {
+			return nil, errors.Errorf("%v is not a %v", raw, numberType)
+		}
+		v = decimal
+	}
+	if numberType == "float" {
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, errors.Errorf("%v is not a float", v)
+		}
+		return f, nil
+	}
+	decimal, ok, err := toDecimal(v)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("%v is not a decimal", v)
+	}
+
+	return decimal, nil
+
+}
+
+// index returns the item at the given index of a list or the field with the given key of a map
+// Strings holding a JSON object or array, such as a response stored in res, are decoded first
+// The fields of a Response are returned by name, anything else is read from its res array or body
+func index(v interface{}, i interface{}) (interface{}, error) {
+
+	if res, ok := v.(Response); ok {
+		if val, ok := res.field(fmt.Sprintf("%v", i)); ok {
+			return val, nil
+		}
+		v = res.value()
+	}
+	if raw, ok := v.(string); ok {
+		trimmed := strings.TrimSpace(raw)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			if val, err := parseJSON(trimmed); err == nil {
+				v = val
+			}
+		}
+	}
+
+	var items []interface{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		key := fmt.Sprintf("%v", i)
+		val, ok := v[key]
+		if !ok {
+			return nil, errors.Errorf("field %v not found", key)
+		}
+		return val, nil
+	case []interface{}, []string, []int:
+		items, _ = toList(v)
+	default:
+		return nil, errors.Errorf("%v can not be indexed", v)
+	}
+	n, ok := toInt(i)
+	if !ok {
+		return nil, errors.Errorf("list index %v is not an int", i)
+	}
+	if n < 0 || n >= len(items) {
+		return nil, errors.Errorf("index %v out of range for list of length %v", n, len(items))
+	}
+
+	return items[n], nil
+
+}
+
+// length returns the number of items in a list or map or the number of characters in a string
+func length(v interface{}) (int, error) {
+	if res, ok := v.(Response); ok {
+		v = res.value()
+	}
+	switch v := v.(type) {
+	case string:
+		return len([]rune(v)), nil
+	case []interface{}:
+		return len(v), nil
+	case []string:
+		return len(v), nil
+	case []int:
+		return len(v), nil
+	case map[string]interface{}:
+		return len(v), nil
+	}
+	return 0, errors.Errorf("%v has no length", v)
+}
+
+// toObject converts a JSON object, or a string holding a JSON object, to a map
+func toObject(v interface{}) (map[string]interface{}, error) {
+
+	if res, ok := v.(Response); ok {
+		v = res.Body
+	}
+	if raw, ok := v.(string); ok {
+		jsonMap := make(map[string]interface{})
+		err := json.Unmarshal([]byte(raw), &jsonMap)
+		if err != nil {
+			return nil, err
+		}
+		return jsonMap, nil
+	}
+	jsonMap, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("%v is not a JSON object", v)
+	}
+
+	return jsonMap, nil
+
+}
+
+// toHeaders converts a map or a list of "Key: Value" strings to HTTP request headers
+// A string is parsed in the legacy format, where the headers are separated by sep
+// and every key is mapped to its value with assign
+// Eg: "Monkey:::Madness---Content-Type:::application/json" with sep "---" and assign ":::"
+func toHeaders(v interface{}, sep string, assign string) (map[string]string, error) {
+
+	headers := make(map[string]string)
+	if raw, ok := v.(string); ok {
+		for _, header := range strings.Split(raw, sep) {
+			if header == "" {
+				continue
+			}
+			keyValue := strings.Split(header, assign)
+			if len(keyValue) != 2 {
+				return nil, errors.Errorf("header is not in the format 'key%vvalue'", assign)
+			}
+			headers[keyValue[0]] = keyValue[1]
+		}
+		return headers, nil
+	}
+	if headersMap, ok := v.(map[string]interface{}); ok {
+		for key, val := range headersMap {
+			headers[key] = fmt.Sprintf("%v", val)
+		}
+		return headers, nil
+	}
+
+	items, err := toStrings(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range items {
+		keyValue := strings.SplitN(header, ":", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.Errorf("header %v is not in the format 'Key: Value'", header)
+		}
+		headers[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+	}
+
+	return headers, nil
+
+}
+
+// matches returns true if the text contains the pattern or the pattern is a regular expression that matches the text
+func matches(text string, pattern string) bool {
+	if strings.Contains(text, pattern) {
+		return true
+	}
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(text)
+}
+
+// compileRegexp compiles a regular expression given to a data function
+func compileRegexp(re string) (*regexp.Regexp, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid regular expression %v", re)
+	}
+	return r, nil
+}
+
+// readRows reads the rows of a CSV file or a JSON file holding an array of objects
+// The first line of a CSV file holds the names of the columns and every cell is read as a string
+func readRows(filepath string) ([]map[string]interface{}, error) {
+
+	dataRaw, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".json":
+		val, err := parseJSON(string(dataRaw))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse %v as JSON", filepath)
+		}
+		return toRows(val)
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(dataRaw)).ReadAll()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse %v as CSV", filepath)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		columns := records[0]
+		rows := make([]map[string]interface{}, len(records)-1)
+		for i, record := range records[1:] {
+			rows[i] = make(map[string]interface{})
+			for j, column := range columns {
+				rows[i][strings.TrimSpace(column)] = record[j]
+			}
+		}
+		return rows, nil
+	}
+
+	return nil, errors.Errorf("%v is not a .csv or .json file", filepath)
+
+}
+
+// toRows converts a JSON array of objects to a list of rows
+func toRows(v interface{}) ([]map[string]interface{}, error) {
+
+	items, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("row %v is not a JSON object: %v", i+1, item)
+		}
+		rows[i] = row
+	}
+
+	return rows, nil
+
+}
@@ -7,9 +7,16 @@ import (
 // Tree supports storage of cascading errors
 // All errors that are thrown in the Data API process
 // will be added to the tree, pruned for successes and failures and returned
+// File, Line and Col are the source position the node was created from
+// and are left empty for nodes that do not map back to a line of code
+// TimedOut is true for nodes that were cut short because they ran out of time
 type Tree struct {
-	Data  string
-	Nodes []*Tree
+	Data     string
+	File     string
+	Line     int
+	Col      int
+	TimedOut bool
+	Nodes    []*Tree
 }
 
 // Add inserts a parent and its child to tree
@@ -23,6 +30,16 @@ func (t *Tree) Add(parent string, child string) {
 	t.AddTree(otherTree)
 }
 
+// AddNode appends the given node as a child of the tree
+// Unlike Add, the node is never merged into an existing node with the same data
+// Eg: 1->2 + 2
+// Will result in:
+// 1->2
+//  ->2
+func (t *Tree) AddNode(node *Tree) {
+	t.Nodes = append(t.Nodes, node)
+}
+
 // AddTree is the same as Add but can add an entire tree instead of just 2 nodes
 // Eg: 1->2->3 + 2->3->4
 // Will result in:
@@ -88,8 +105,8 @@ func (t Tree) GetFailures() ([]string, error) {
 		}
 
 		if len(node.Nodes) != 0 && len(node.Nodes[0].Nodes) == 0 {
-			out = append(out, fmt.Sprintf("%v: %v", t.Data, node.Data))
-			out = append(out, fmt.Sprintf("%v: %v", node.Data, node.Nodes[0].Data))
+			out = append(out, fmt.Sprintf("%v: %v", t.Label(), node.Label()))
+			out = append(out, fmt.Sprintf("%v: %v", node.Label(), node.Nodes[0].Label()))
 			continue
 		}
 
@@ -98,7 +115,7 @@ func (t Tree) GetFailures() ([]string, error) {
 			return nil, err
 		}
 		if len(failures) != 0 {
-			out = append(out, fmt.Sprintf("%v: %v", t.Data, node.Data))
+			out = append(out, fmt.Sprintf("%v: %v", t.Label(), node.Label()))
 			out = append(out, failures...)
 		}
 	}
@@ -131,7 +148,7 @@ func (t Tree) GetSuccesses() ([]string, error) {
 			if err != nil {
 				return nil, err
 			}
-			out = append(out, fmt.Sprintf("%v: %v", t.Data, node.Data))
+			out = append(out, fmt.Sprintf("%v: %v", t.Label(), node.Label()))
 			out = append(out, successes...)
 		}
 
@@ -140,6 +157,22 @@ func (t Tree) GetSuccesses() ([]string, error) {
 	return out, nil
 }
 
+// Label returns the data of the node prefixed with its source position
+// Eg: configs/dataapi/test.txt:3:1: [AssertEquals(a, b)]
+// Nodes without a source position return their data as is
+// Nodes that timed out are marked as such
+// Eg: configs/dataapi/test.txt:4:1: [Sleep(10)] (timed out)
+func (t Tree) Label() string {
+	label := t.Data
+	if t.File != "" {
+		label = fmt.Sprintf("%v:%v:%v: %v", t.File, t.Line, t.Col, t.Data)
+	}
+	if t.TimedOut {
+		label += " (timed out)"
+	}
+	return label
+}
+
 // Passes returns true if every Node does not contain an error
 func (t Tree) Passes() bool {
 	passedNodes := 0
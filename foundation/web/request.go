@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/dimfeld/httptreemux"
 	en "github.com/go-playground/locales/en"
@@ -68,18 +70,23 @@ func Decode(
 	return nil
 }
 
+// RequestTimeout is the longest DoRequest waits for a response
+// The request is stopped sooner if the context is cancelled or reaches its deadline first
+var RequestTimeout = 60 * time.Second
+
 // DoRequest handles sending a basic HTTP request to any URL
 // and get a response as []byte
-func DoRequest(url string, headers map[string]string, httpMethod string, data interface{}) ([]byte, error) {
+// The request is cancelled along with the given context
+func DoRequest(ctx context.Context, url string, headers map[string]string, httpMethod string, data interface{}) ([]byte, error) {
 
 	// Create the http request
 	// Encode the data and set its content type in the case of an http POST
 	var req *http.Request
 	var err error
 	if httpMethod == http.MethodPost {
-		req, err = http.NewRequest(httpMethod, url, Encode(data))
+		req, err = http.NewRequestWithContext(ctx, httpMethod, url, Encode(data))
 	} else if httpMethod == http.MethodGet {
-		req, err = http.NewRequest(httpMethod, url, nil)
+		req, err = http.NewRequestWithContext(ctx, httpMethod, url, nil)
 	} else {
 		err = errors.New(fmt.Sprintf("unrecognized httpMethod %v", httpMethod))
 	}
@@ -91,7 +98,7 @@ func DoRequest(url string, headers map[string]string, httpMethod string, data in
 	}
 
 	// Attempt to do http request
-	client := &http.Client{}
+	client := &http.Client{Timeout: RequestTimeout}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
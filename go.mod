@@ -3,17 +3,14 @@ module github.com/Celbux/dataapi
 go 1.16
 
 require (
-	cloud.google.com/go/datastore v1.6.0
 	github.com/ardanlabs/conf v1.5.0
 	github.com/dimfeld/httptreemux v5.0.1+incompatible
 	github.com/go-playground/locales v0.14.0
 	github.com/go-playground/universal-translator v0.18.0
+	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/google/uuid v1.3.0
-	github.com/googleapis/gax-go/v2 v2.1.1
-	github.com/japm/goScript v0.0.0-20170421184750-caab90145b05
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/pkg/errors v0.9.1
-	google.golang.org/genproto v0.0.0-20210927142257-433400c27d05
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.31.0
 )
@@ -8,8 +8,12 @@ import (
 	"github.com/Celbux/dataapi/foundation/web"
 	"github.com/pkg/errors"
 	"net/http"
+	"time"
 )
 
+// DataAPIHandlers serves the Data API over HTTP
+// The core backend that data code calls into is configured with Service.Core,
+// Eg: a host service sets it to its own CoreDataAPI and tests set it to a dataapi.FakeCore
 type DataAPIHandlers struct {
 	Service dataapi.DataAPIService
 }
@@ -20,7 +24,7 @@ func (d DataAPIHandlers) evaluateHandler(
 	r *http.Request,
 ) error {
 
-	failures, successes, err := d.evaluate(ctx, r)
+	failures, successes, seed, err := d.evaluate(ctx, r)
 	if err != nil {
 		if _, ok := errors.Cause(err).(*dataapi.Error); ok {
 
@@ -38,49 +42,116 @@ func (d DataAPIHandlers) evaluateHandler(
 	response := struct {
 		Failures []string
 		Successes []string
+		Seed int64
 	}{
 		Failures: failures,
 		Successes: successes,
+		Seed: seed,
 	}
 	return web.Respond(ctx, w, response, http.StatusOK)
 
 }
 
+// checkHandler will find problems in the data code found in the given file without running it
+func (d DataAPIHandlers) checkHandler(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+
+	problems, err := d.check(ctx, r)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*dataapi.Error); ok {
+
+			response := struct {
+				Error string `json:"Error"`
+			}{
+				Error: err.Error(),
+			}
+
+			return web.Respond(ctx, w, response, http.StatusBadRequest)
+		}
+		return err
+	}
+
+	response := struct {
+		Problems []string
+	}{
+		Problems: problems,
+	}
+	return web.Respond(ctx, w, response, http.StatusOK)
+
+}
+
+// check will find problems in the data code found in the given file without running it
+// The file must exist as a relative path to the running server
+func (d DataAPIHandlers) check(ctx context.Context, r *http.Request) ([]string, error) {
+
+	// Get file name from request body
+	// The file contains the data code we want to check
+	type request struct {
+		File string `json:"File"`
+	}
+	req := request{}
+	err := web.Decode(r, &req)
+	if err != nil {
+		return nil, &dataapi.Error{Err: errors.New(fmt.Sprintf("error check/web.Decode: %v", err.Error()))}
+	}
+
+	// Create the eval cache for the service
+	d.Service.EvalCache = make(map[string]interface{})
+
+	// Check all expressions in input filename
+	problems := d.Service.Check(req.File)
+	if problems == nil {
+		problems = []string{}
+	}
+
+	return problems, nil
+
+}
+
 // evaluate will run the data code found in the given file
 // The file must exist as a relative path to the running server
-func (d DataAPIHandlers) evaluate(ctx context.Context, r *http.Request, ) ([]string, []string, error) {
+// The seed of the run is returned, and giving it back in the request replays the run with the same random data
+// A Clock in RFC3339 freezes the time returned by Now for the whole run
+func (d DataAPIHandlers) evaluate(ctx context.Context, r *http.Request, ) ([]string, []string, int64, error) {
 
 	// Get file name from request body
 	// The file contains the data code we want to run live
 	type request struct {
 		File string `json:"File"`
+		Seed int64 `json:"Seed"`
+		Clock time.Time `json:"Clock"`
 	}
 	req := request{}
 	err := web.Decode(r, &req)
 	if err != nil {
-		return nil, nil, &dataapi.Error{Err: errors.New(fmt.Sprintf("error evaluate/web.Decode: %v", err.Error()))}
+		return nil, nil, 0, &dataapi.Error{Err: errors.New(fmt.Sprintf("error evaluate/web.Decode: %v", err.Error()))}
 	}
 
-	// Create the eval cache the service
+	// Create the eval cache for the service
 	d.Service.EvalCache = make(map[string]interface{})
-	d.Service.EvalCache["dataapi"] = &d.Service
+	d.Service.Seed = req.Seed
+	d.Service.Clock = req.Clock
 
 	// Evaluate all expressions in input filename
-	resultsRaw := d.Service.Evaluate(req.File)
+	resultsRaw := d.Service.Evaluate(ctx, req.File)
 	report, ok := resultsRaw["report"].(*tools.Tree)
 	if !ok {
-		return nil, nil, errors.Errorf("evaluate fatal: %v", resultsRaw)
+		return nil, nil, 0, errors.Errorf("evaluate fatal: %v", resultsRaw)
 	}
+	seed, _ := resultsRaw["seed"].(int64)
 
 	// Return the test results
 	failures, successes, err := d.Service.GetResults(*report)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 
 	if len(failures) == 0 {
 		successes = append(successes, fmt.Sprintf("%v: passed", req.File))
 	}
-	return failures, successes, nil
+	return failures, successes, seed, nil
 
 }
@@ -29,6 +29,7 @@ func API(
 	app.Handle(http.MethodGet, "/readiness", check.readiness)
 	app.Handle(http.MethodGet, "/liveness", check.liveness)
 	app.Handle(http.MethodPost, "/evaluate", dataapi.evaluateHandler)
+	app.Handle(http.MethodPost, "/check", dataapi.checkHandler)
 
 	return app
 
@@ -6,6 +6,7 @@ import (
 	"github.com/Celbux/dataapi/business/dataapi"
 	"github.com/Celbux/dataapi/services/dataapi/handlers"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -41,6 +42,17 @@ func run(log *log.Logger) error {
 			WriteTimeout    time.Duration `conf:"default:0s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
 		}
+		Core struct {
+			URL       string
+			Functions []string
+		}
+		Limits struct {
+			MaxIterations int `conf:"default:10000"`
+			MaxSteps      int `conf:"default:1000000"`
+		}
+		Secrets struct {
+			File string
+		}
 	}
 	namespace := "DATA_API"
 	if err := conf.Parse(os.Args[1:], namespace, &cfg); err != nil {
@@ -70,8 +82,27 @@ func run(log *log.Logger) error {
 
 	// Dependency Injection: Create our Services with their dependencies to
 	// attach on for later access via receiver functions
+	// Data code can only call core functions when a core service is configured
 	dataAPI := handlers.DataAPIHandlers{
-		Service: dataapi.DataAPIService{Log: log},
+		Service: dataapi.DataAPIService{
+			Limits: dataapi.Limits{
+				MaxIterations: cfg.Limits.MaxIterations,
+				MaxSteps:      cfg.Limits.MaxSteps,
+			},
+			Log: log,
+		},
+	}
+	if cfg.Core.URL != "" {
+		dataAPI.Service.Core = dataapi.HTTPCore{URL: cfg.Core.URL, Names: cfg.Core.Functions}
+	}
+
+	// Data code reads tokens and passwords with Secret from the secrets file, or the environment without one
+	if cfg.Secrets.File != "" {
+		secrets, err := dataapi.LoadSecrets(cfg.Secrets.File)
+		if err != nil {
+			return errors.Wrap(err, "loading secrets")
+		}
+		dataAPI.Service.Secrets = secrets
 	}
 
 	// Make a channel to listen for an interrupt or terminate signal from the
@@ -79,6 +110,11 @@ func run(log *log.Logger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// Requests run under a context that is cancelled when the server shuts down,
+	// so a running evaluation stops instead of holding up the shutdown
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	// Create the server that will listen and serve
 	api := http.Server{
 		Addr: cfg.Web.APIHost,
@@ -89,6 +125,9 @@ func run(log *log.Logger) error {
 		),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	// Make a channel to listen for errors coming from the listener. Use a
@@ -109,6 +148,7 @@ func run(log *log.Logger) error {
 
 	case sig := <-shutdown:
 		log.Printf("main: %v : Start shutdown", sig)
+		cancelRequests()
 
 		// Give outstanding requests a deadline for completion.
 		ctx, cancel := context.WithTimeout(